@@ -0,0 +1,147 @@
+package trie
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// hit is a word-final node reached by a search, with the best score it was reached with.
+type hit[N any] struct {
+	node N
+	word string
+	score
+}
+
+// collector gathers the hits of a search. Without a limit it keeps every word it is given.
+// With a positive limit it keeps only the best limit words in a heap with the worst of them
+// on top, which gives the bound that lets the traversal skip branches of the trie.
+type collector[N any] struct {
+	limit int
+	hits  []hit[N]
+	// index maps a word to its position in hits.
+	index map[string]int
+}
+
+func newCollector[N any](limit int) *collector[N] {
+	return &collector[N]{limit: limit, index: make(map[string]int)}
+}
+
+// add records that word, ending at node n, was reached with score sc.
+func (c *collector[N]) add(n N, word string, sc score) {
+	if i, ok := c.index[word]; ok {
+		if sc.improves(c.hits[i].score) {
+			c.hits[i].score = sc
+			if c.limit > 0 {
+				heap.Fix(c, i)
+			}
+		}
+		return
+	}
+	switch {
+	case c.limit <= 0:
+		c.index[word] = len(c.hits)
+		c.hits = append(c.hits, hit[N]{node: n, word: word, score: sc})
+	case len(c.hits) < c.limit:
+		heap.Push(c, hit[N]{node: n, word: word, score: sc})
+	case rankedBefore(word, sc, c.hits[0].word, c.hits[0].score):
+		delete(c.index, c.hits[0].word)
+		c.hits[0] = hit[N]{node: n, word: word, score: sc}
+		c.index[word] = 0
+		heap.Fix(c, 0)
+	}
+}
+
+// prunes reports whether the collector is full and a word scoring no better than bound, and
+// sorting no earlier than prefix, could not displace any of the words it holds. The length of
+// bound is the length of prefix, so a longer word under it scores worse than bound.
+func (c *collector[N]) prunes(bound score, prefix []byte) bool {
+	if c.limit <= 0 || len(c.hits) < c.limit {
+		return false
+	}
+	worst := c.hits[0]
+	if cmp := compareScores(bound, worst.score); cmp != 0 {
+		return cmp > 0
+	}
+	return string(prefix) >= worst.word
+}
+
+// sorted returns the collected hits from best to worst.
+func (c *collector[N]) sorted() []hit[N] {
+	sort.Slice(c.hits, func(i, j int) bool {
+		return rankedBefore(c.hits[i].word, c.hits[i].score, c.hits[j].word, c.hits[j].score)
+	})
+	return c.hits
+}
+
+// Len, Less, Swap, Push and Pop implement heap.Interface with the worst hit on top.
+func (c *collector[N]) Len() int { return len(c.hits) }
+
+func (c *collector[N]) Less(i, j int) bool {
+	return rankedBefore(c.hits[j].word, c.hits[j].score, c.hits[i].word, c.hits[i].score)
+}
+
+func (c *collector[N]) Swap(i, j int) {
+	c.hits[i], c.hits[j] = c.hits[j], c.hits[i]
+	c.index[c.hits[i].word] = i
+	c.index[c.hits[j].word] = j
+}
+
+func (c *collector[N]) Push(x any) {
+	h := x.(hit[N])
+	c.index[h.word] = len(c.hits)
+	c.hits = append(c.hits, h)
+}
+
+func (c *collector[N]) Pop() any {
+	h := c.hits[len(c.hits)-1]
+	c.hits = c.hits[:len(c.hits)-1]
+	delete(c.index, h.word)
+	return h
+}
+
+// compareScores orders two scores by levenshtein distance, then matches without skipped
+// characters before fuzzy ones, then whole-word matches before completions, then by descending
+// weight, then by descending selections, then words starting with the search string as typed
+// before the others, then shorter words before longer ones. It returns a negative number when
+// a ranks before b, a positive one when b ranks before a and zero when only the words can tell
+// them apart.
+func compareScores(a, b score) int {
+	switch {
+	case a.levenshtein != b.levenshtein:
+		return int(a.levenshtein) - int(b.levenshtein)
+	case a.fuzzy != b.fuzzy:
+		if a.fuzzy {
+			return 1
+		}
+		return -1
+	case a.exact != b.exact:
+		if a.exact {
+			return -1
+		}
+		return 1
+	case a.weight > b.weight:
+		return -1
+	case a.weight < b.weight:
+		return 1
+	case a.selections > b.selections:
+		return -1
+	case a.selections < b.selections:
+		return 1
+	case a.typed != b.typed:
+		if a.typed {
+			return -1
+		}
+		return 1
+	default:
+		return a.length - b.length
+	}
+}
+
+// rankedBefore reports whether the hit a with score sa should be listed before the hit b with
+// score sb. Hits are ordered by their scores and then alphabetically.
+func rankedBefore(a string, sa score, b string, sb score) bool {
+	if cmp := compareScores(sa, sb); cmp != 0 {
+		return cmp < 0
+	}
+	return a < b
+}
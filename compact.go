@@ -0,0 +1,613 @@
+package trie
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Compact file layout, all integers are little endian uint32 unless noted:
+//
+//	header     compactHeaderSize bytes: magic, version, flags, the counts and sizes of the
+//	           sections below, the index of the root node of the word starts or zero for
+//	           none, the half-life of selections in nanoseconds as a uint64, and the
+//	           levenshtein scheme as (search string length, distance) byte pairs
+//	language   the BCP 47 tag of the casing rules, empty for none
+//	nodes      compactNodeSize bytes per node in breadth first order, root first: the rune
+//	           leading to the node, the index of its first child, its number of children,
+//	           its terminal index plus one or zero, and its maxWeight and maxSelections as
+//	           float64s
+//	terminals  compactTerminalSize bytes per word: offset and length of the word in strings,
+//	           the weight as a float64, the index of the first original and their number, the
+//	           metadata index plus one or zero for nil metadata, four bytes of padding, and the
+//	           selections as a float64 and the time of the latest one in Unix nanoseconds as an
+//	           int64
+//	originals  compactOriginalSize bytes per original word: offset and length in strings, and
+//	           the metadata index plus one or zero for nil metadata
+//	metas      offset and length in metadata per encoded metadata value
+//	strings    the bytes of all words and originals
+//	metadata   the bytes of all metadata encoded with a MetaCodec
+//
+// The children of a node are stored next to each other in rune order, so they can be
+// binary searched in place. The nodes of the word starts follow the nodes of the words, and
+// their originals are the keys of the entries whose later words they start. A compact index
+// is only read by the version that wrote it; an index of another version has to be written
+// again from its trie, which keeps its own snapshot format readable.
+const (
+	compactMagic   = "GATCMPCT"
+	compactVersion = 2
+
+	compactHalfLifeOffset = 52
+	compactSchemeOffset   = compactHalfLifeOffset + 8
+	compactHeaderSize     = compactSchemeOffset + 2*maxSchemePairs
+	compactNodeSize       = 32
+	compactTerminalSize   = 48
+	compactRangeSize      = 8
+	compactOriginalSize   = 12
+
+	// maxSchemePairs is the number of levenshtein scheme entries a compact header has room for.
+	maxSchemePairs = 32
+)
+
+// ErrInvalidCompact is returned when data is not a compact index written by WriteCompact.
+var ErrInvalidCompact = errors.New("trie: invalid compact index")
+
+// Compact is a read-only form of a Trie that stores its nodes in flat sorted arrays instead of
+// maps, and every word and original only once. It supports the same searches as the Trie it
+// was built from, and is safe for concurrent use. A Compact can be read straight from a file
+// with OpenCompact, which maps the file into memory so that processes opening the same file
+// share one copy of the index.
+type Compact struct {
+	settings
+	nodes, terminals, originalRanges, metaRanges, strings []byte
+	close                                                 func() error
+	// startsRoot is the node index of the root of the word starts, zero when there are none.
+	startsRoot uint32
+	// metas holds the metadata of a Compact built by Freeze. A Compact loaded from data has a
+	// codec instead, which decodes the metadata in metaData when it is first read, and keeps
+	// it in decoded. metaErr holds the first error decoding it.
+	metas    []interface{}
+	metaData []byte
+	codec    MetaCodec
+	decoded  []atomic.Pointer[interface{}]
+	metaErr  atomic.Pointer[error]
+}
+
+// Freeze builds a Compact holding the current contents and settings of the trie. The Compact
+// holds the metadata values of the trie themselves, so they are not encoded with its codec.
+func (t *Trie) Freeze() (*Compact, error) {
+	t.rlock()
+	defer t.runlock()
+	c := &Compact{}
+	c.normaliser = t.normaliser
+	if err := c.setFlags(t.flags(), ErrInvalidCompact); err != nil {
+		return nil, err
+	}
+	c.setLevenshtein(maps.Clone(t.levenshteinScheme))
+	c.language, c.halfLife = t.language, t.halfLife
+	sections, err := t.compactSections(func(meta interface{}) (uint32, error) {
+		c.metas = append(c.metas, meta)
+		return uint32(len(c.metas)), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.nodes, c.terminals, c.originalRanges, c.strings = sections.nodes, sections.terminals, sections.originals, sections.strs
+	c.startsRoot = sections.startsRoot
+	return c, nil
+}
+
+// WriteCompact writes the trie in the compact format read by LoadCompact and OpenCompact.
+// Metadata is encoded with the trie's codec.
+func (t *Trie) WriteCompact(w io.Writer) (int64, error) {
+	t.rlock()
+	defer t.runlock()
+	return t.writeCompact(w)
+}
+
+// writeCompact is WriteCompact for a caller holding the lock.
+func (t *Trie) writeCompact(w io.Writer) (int64, error) {
+	if len(t.levenshteinScheme) > maxSchemePairs {
+		return 0, fmt.Errorf("trie: levenshtein scheme has more than %d entries", maxSchemePairs)
+	}
+	codec := t.codec()
+	var metaRanges, metas []byte
+	sections, err := t.compactSections(func(meta interface{}) (uint32, error) {
+		data, err := codec.EncodeMeta(meta)
+		if err != nil {
+			return 0, err
+		}
+		metaRanges = binary.LittleEndian.AppendUint32(metaRanges, uint32(len(metas)))
+		metaRanges = binary.LittleEndian.AppendUint32(metaRanges, uint32(len(data)))
+		metas = append(metas, data...)
+		return uint32(len(metaRanges) / compactRangeSize), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	nodes, terminals, originals, strs, startsRoot := sections.nodes, sections.terminals, sections.originals, sections.strs, sections.startsRoot
+	if len(strs) > math.MaxUint32 || len(metas) > math.MaxUint32 {
+		return 0, errors.New("trie: too large for the compact format")
+	}
+	header := make([]byte, 0, compactHeaderSize)
+	header = append(header, compactMagic...)
+	header = binary.LittleEndian.AppendUint32(header, compactVersion)
+	header = binary.LittleEndian.AppendUint32(header, uint32(t.flags()))
+	for _, count := range []int{
+		len(nodes) / compactNodeSize,
+		len(terminals) / compactTerminalSize,
+		len(originals) / compactOriginalSize,
+		len(metaRanges) / compactRangeSize,
+		len(strs),
+		len(metas),
+		len(t.levenshteinScheme),
+		len(languageString(t.language)),
+		int(startsRoot),
+	} {
+		header = binary.LittleEndian.AppendUint32(header, uint32(count))
+	}
+	header = binary.LittleEndian.AppendUint64(header, uint64(t.halfLife))
+	lengths := make([]uint8, 0, len(t.levenshteinScheme))
+	for length := range t.levenshteinScheme {
+		lengths = append(lengths, length)
+	}
+	slices.Sort(lengths)
+	for _, length := range lengths {
+		header = append(header, length, t.levenshteinScheme[length])
+	}
+	header = header[:compactHeaderSize]
+
+	var written int64
+	lang := []byte(languageString(t.language))
+	for _, section := range [][]byte{header, lang, nodes, terminals, originals, metaRanges, strs, metas} {
+		n, err := w.Write(section)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// compactSections holds the nodes, terminals, originals and strings sections of the compact
+// form of a trie, and the node index of the root of its word starts.
+type compactSections struct {
+	nodes, terminals, originals, strs []byte
+	startsRoot                        uint32
+}
+
+// compactSections lays out the nodes of t in the compact format for a caller holding the lock.
+// addMeta stores a metadata value that is not nil and returns its index plus one.
+func (t *Trie) compactSections(addMeta func(meta interface{}) (uint32, error)) (compactSections, error) {
+	var nodes, terminals, originals, strs []byte
+	addString := func(s string, to []byte) []byte {
+		to = binary.LittleEndian.AppendUint32(to, uint32(len(strs)))
+		to = binary.LittleEndian.AppendUint32(to, uint32(len(s)))
+		strs = append(strs, s...)
+		return to
+	}
+	appendMeta := func(meta interface{}, to []byte) ([]byte, error) {
+		if meta == nil {
+			return binary.LittleEndian.AppendUint32(to, 0), nil
+		}
+		slot, err := addMeta(meta)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(to, slot), nil
+	}
+	// queue holds the nodes in breadth first order, with the rune leading to them.
+	type queued struct {
+		r rune
+		n *node
+	}
+	queue := []queued{{0, t.root}}
+	next := uint32(1)
+	startsRoot := uint32(0)
+	for i := 0; i < len(queue); i++ {
+		r, n := queue[i].r, queue[i].n
+		keys := make([]rune, 0, len(n.children))
+		for character := range n.children {
+			keys = append(keys, character)
+		}
+		slices.Sort(keys)
+		nodes = binary.LittleEndian.AppendUint32(nodes, uint32(r))
+		nodes = binary.LittleEndian.AppendUint32(nodes, next)
+		nodes = binary.LittleEndian.AppendUint32(nodes, uint32(len(keys)))
+		next += uint32(len(keys))
+		for _, character := range keys {
+			queue = append(queue, queued{character, n.children[character]})
+		}
+		if n.word == "" {
+			nodes = binary.LittleEndian.AppendUint32(nodes, 0)
+		} else {
+			nodes = binary.LittleEndian.AppendUint32(nodes, uint32(len(terminals)/compactTerminalSize)+1)
+			terminals = addString(n.word, terminals)
+			terminals = binary.LittleEndian.AppendUint64(terminals, math.Float64bits(n.weight))
+			terminals = binary.LittleEndian.AppendUint32(terminals, uint32(len(originals)/compactOriginalSize))
+			terminals = binary.LittleEndian.AppendUint32(terminals, uint32(len(n.variants)))
+			var err error
+			for _, v := range n.variants {
+				originals = addString(v.word, originals)
+				if originals, err = appendMeta(v.meta, originals); err != nil {
+					return compactSections{}, err
+				}
+			}
+			if terminals, err = appendMeta(n.meta, terminals); err != nil {
+				return compactSections{}, err
+			}
+			terminals = binary.LittleEndian.AppendUint32(terminals, 0)
+			terminals = binary.LittleEndian.AppendUint64(terminals, math.Float64bits(n.selections))
+			terminals = binary.LittleEndian.AppendUint64(terminals, uint64(n.selectedAt))
+		}
+		nodes = binary.LittleEndian.AppendUint64(nodes, math.Float64bits(n.maxWeight))
+		nodes = binary.LittleEndian.AppendUint64(nodes, math.Float64bits(n.maxSelections))
+		if i == len(queue)-1 && startsRoot == 0 && t.wordStarts {
+			// the word starts follow the tree of the words
+			starts := t.starts
+			if starts == nil {
+				starts = &node{}
+			}
+			startsRoot = next
+			queue = append(queue, queued{0, starts})
+			next++
+		}
+	}
+	return compactSections{nodes, terminals, originals, strs, startsRoot}, nil
+}
+
+// LoadCompact returns a Compact reading from data, which must hold an index written by
+// WriteCompact and must not be modified while the Compact is in use. Metadata is decoded with
+// codec, or with GobCodec when codec is nil, when it is first read, so that an index mapped by
+// several processes is not copied onto the heap of each. Metadata that codec cannot decode
+// reads as nil, and MetaErr returns the first error decoding it. The index holds its own
+// settings, so of opts only CustomNormaliser is used, to supply the normaliser an index was
+// built with.
+func LoadCompact(data []byte, codec MetaCodec, opts ...Option) (*Compact, error) {
+	if len(data) < compactHeaderSize || string(data[:len(compactMagic)]) != compactMagic {
+		return nil, fmt.Errorf("%w: bad header", ErrInvalidCompact)
+	}
+	header := data[len(compactMagic):compactHeaderSize]
+	field := func(i int) uint64 { return uint64(binary.LittleEndian.Uint32(header[4*i:])) }
+	if version := field(0); version != compactVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidCompact, version)
+	}
+	flags := field(1)
+	nodeCount, terminalCount, originalCount, metaCount := field(2), field(3), field(4), field(5)
+	stringsSize, metasSize, pairs, languageSize := field(6), field(7), field(8), field(9)
+	startsRoot := field(10)
+	halfLife := time.Duration(binary.LittleEndian.Uint64(data[compactHalfLifeOffset:]))
+	if halfLife < 0 || pairs > maxSchemePairs || nodeCount == 0 || startsRoot >= nodeCount || (startsRoot != 0) != (flags&flagWordStarts != 0) {
+		return nil, fmt.Errorf("%w: bad header", ErrInvalidCompact)
+	}
+	c := &Compact{}
+	for _, opt := range opts {
+		var supplied settings
+		if err := opt(&supplied); err != nil {
+			return nil, err
+		}
+		if supplied.normaliser != nil {
+			c.normaliser = supplied.normaliser
+		}
+	}
+	if err := c.setFlags(uint32(flags), ErrInvalidCompact); err != nil {
+		return nil, err
+	}
+	scheme := make(map[uint8]uint8, pairs)
+	for i := uint64(0); i < pairs; i++ {
+		scheme[data[compactSchemeOffset+2*i]] = data[compactSchemeOffset+2*i+1]
+	}
+	if _, ok := scheme[0]; !ok {
+		return nil, fmt.Errorf("%w: invalid levenshtein scheme", ErrInvalidCompact)
+	}
+	c.setLevenshtein(scheme)
+	c.halfLife = halfLife
+
+	rest := uint64(len(data) - compactHeaderSize)
+	offset := uint64(compactHeaderSize)
+	section := func(size uint64) []byte {
+		if size > rest {
+			rest = 0
+			return nil
+		}
+		s := data[offset : offset+size : offset+size]
+		offset += size
+		rest -= size
+		return s
+	}
+	tag, err := parseLanguage(string(section(languageSize)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCompact, err)
+	}
+	c.language = tag
+	c.startsRoot = uint32(startsRoot)
+	c.nodes = section(nodeCount * compactNodeSize)
+	c.terminals = section(terminalCount * compactTerminalSize)
+	c.originalRanges = section(originalCount * compactOriginalSize)
+	c.metaRanges = section(metaCount * compactRangeSize)
+	c.strings = section(stringsSize)
+	metas := section(metasSize)
+	if rest != 0 || uint64(len(metas)) != metasSize {
+		return nil, fmt.Errorf("%w: bad size", ErrInvalidCompact)
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < int(metaCount); i++ {
+		off, length := c.u32(c.metaRanges, i*compactRangeSize), c.u32(c.metaRanges, i*compactRangeSize+4)
+		if uint64(off)+uint64(length) > metasSize {
+			return nil, fmt.Errorf("%w: bad metadata", ErrInvalidCompact)
+		}
+	}
+	if codec == nil {
+		codec = GobCodec{}
+	}
+	c.metaData, c.codec = metas, codec
+	c.decoded = make([]atomic.Pointer[interface{}], metaCount)
+	return c, nil
+}
+
+// OpenCompact opens a file written by WriteCompact. Where the platform supports it the file
+// is mapped into memory rather than read. Metadata is decoded with codec, or with GobCodec
+// when codec is nil, and opts are used like in LoadCompact. The Compact must be closed when it
+// is no longer needed.
+func OpenCompact(path string, codec MetaCodec, opts ...Option) (*Compact, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < compactHeaderSize || info.Size() > math.MaxInt {
+		return nil, fmt.Errorf("%w: bad size", ErrInvalidCompact)
+	}
+	data, unmap, err := mapFile(f, int(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+	c, err := LoadCompact(data, codec, opts...)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	c.close = unmap
+	return c, nil
+}
+
+// Close releases the file mapped by OpenCompact. The Compact must not be used afterwards.
+func (c *Compact) Close() error {
+	if c.close == nil {
+		return nil
+	}
+	err := c.close()
+	c.close = nil
+	return err
+}
+
+// MetaErr returns the first error decoding the metadata of a Compact loaded by LoadCompact or
+// OpenCompact, whose metadata read as nil, or nil if every value read so far was decoded.
+func (c *Compact) MetaErr() error {
+	if err := c.metaErr.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// validate checks every reference between the sections, so that searches need no checks.
+func (c *Compact) validate() error {
+	nodeCount := uint64(len(c.nodes) / compactNodeSize)
+	terminalCount := uint64(len(c.terminals) / compactTerminalSize)
+	originalCount := uint64(len(c.originalRanges) / compactOriginalSize)
+	metaCount := uint64(len(c.metaRanges) / compactRangeSize)
+	stringsSize := uint64(len(c.strings))
+	for n := uint64(0); n < nodeCount; n++ {
+		first, count, terminal := c.node(uint32(n))
+		if uint64(first)+uint64(count) > nodeCount || (count > 0 && uint64(first) <= n) {
+			return fmt.Errorf("%w: bad node", ErrInvalidCompact)
+		}
+		for i := first + 1; i < first+count; i++ {
+			if c.nodeRune(i-1) >= c.nodeRune(i) {
+				return fmt.Errorf("%w: unsorted children", ErrInvalidCompact)
+			}
+		}
+		if uint64(terminal) > terminalCount {
+			return fmt.Errorf("%w: bad node", ErrInvalidCompact)
+		}
+	}
+	for t := uint64(0); t < terminalCount; t++ {
+		base := int(t) * compactTerminalSize
+		if uint64(c.u32(c.terminals, base))+uint64(c.u32(c.terminals, base+4)) > stringsSize ||
+			uint64(c.u32(c.terminals, base+16))+uint64(c.u32(c.terminals, base+20)) > originalCount ||
+			uint64(c.u32(c.terminals, base+24)) > metaCount {
+			return fmt.Errorf("%w: bad word", ErrInvalidCompact)
+		}
+	}
+	for o := uint64(0); o < originalCount; o++ {
+		base := int(o) * compactOriginalSize
+		if uint64(c.u32(c.originalRanges, base))+uint64(c.u32(c.originalRanges, base+4)) > stringsSize ||
+			uint64(c.u32(c.originalRanges, base+8)) > metaCount {
+			return fmt.Errorf("%w: bad original", ErrInvalidCompact)
+		}
+	}
+	return nil
+}
+
+func (c *Compact) u32(section []byte, offset int) uint32 {
+	return binary.LittleEndian.Uint32(section[offset:])
+}
+
+// node returns the first child, the number of children and the terminal index plus one of n.
+func (c *Compact) node(n uint32) (first, count, terminal uint32) {
+	base := int(n) * compactNodeSize
+	return c.u32(c.nodes, base+4), c.u32(c.nodes, base+8), c.u32(c.nodes, base+12)
+}
+
+// nodeRune returns the rune leading to n.
+func (c *Compact) nodeRune(n uint32) rune {
+	return rune(c.u32(c.nodes, int(n)*compactNodeSize))
+}
+
+// terminalOffset returns the offset of the terminal record of n, which must end a word.
+func (c *Compact) terminalOffset(n uint32) int {
+	_, _, terminal := c.node(n)
+	return int(terminal-1) * compactTerminalSize
+}
+
+func (c *Compact) str(section []byte, offset int) string {
+	off, length := c.u32(section, offset), c.u32(section, offset+4)
+	return string(c.strings[off : off+length])
+}
+
+// FindMeta returns the metadata stored for the exact word, if present, exactly like Trie.FindMeta.
+func (c *Compact) FindMeta(word string) (interface{}, bool) {
+	return findMeta[uint32](c, &c.settings, word)
+}
+
+// SearchAll is just like Search, but without a limit.
+func (c *Compact) SearchAll(search string, opts ...Option) []string {
+	return c.Search(search, 0, opts...)
+}
+
+// SearchAllMeta performs a fuzzy search returning words with their metadata.
+func (c *Compact) SearchAllMeta(search string, opts ...Option) []Match {
+	return c.SearchMeta(search, 0, opts...)
+}
+
+// Search returns the words matching the search string, exactly like Trie.Search.
+func (c *Compact) Search(search string, limit int, opts ...Option) []string {
+	matches := c.SearchMeta(search, limit, opts...)
+	words := make([]string, len(matches))
+	for i, match := range matches {
+		words[i] = match.Word
+	}
+	return words
+}
+
+// SearchMeta is just like Search, but returns the words with their metadata.
+func (c *Compact) SearchMeta(search string, limit int, opts ...Option) []Match {
+	matches, _ := searchIndex[uint32](context.Background(), c, &c.settings, search, limit, opts...)
+	return matches
+}
+
+// SearchContext is just like SearchMeta, but gives up when ctx is done. It then returns the
+// matches found so far, which may be missing better ones, together with the context's error.
+func (c *Compact) SearchContext(ctx context.Context, search string, limit int, opts ...Option) ([]Match, error) {
+	return searchIndex[uint32](ctx, c, &c.settings, search, limit, opts...)
+}
+
+// root, child, appendChildren, terminal, word, weight, maxWeight, selections, maxSelections,
+// variants, meta and starts implement index.
+func (c *Compact) root() uint32 { return 0 }
+
+func (c *Compact) child(n uint32, r rune) (uint32, bool) {
+	first, count, _ := c.node(n)
+	low, high := first, first+count
+	for low < high {
+		mid := low + (high-low)/2
+		if c.nodeRune(mid) < r {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+	if low < first+count && c.nodeRune(low) == r {
+		return low, true
+	}
+	return 0, false
+}
+
+func (c *Compact) appendChildren(edges []edge[uint32], n uint32, _ bool) []edge[uint32] {
+	first, count, _ := c.node(n)
+	for i := first; i < first+count; i++ {
+		edges = append(edges, edge[uint32]{c.nodeRune(i), i})
+	}
+	return edges
+}
+
+func (c *Compact) terminal(n uint32) bool {
+	_, _, terminal := c.node(n)
+	return terminal != 0
+}
+
+func (c *Compact) word(n uint32) string {
+	return c.str(c.terminals, c.terminalOffset(n))
+}
+
+func (c *Compact) weight(n uint32) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(c.terminals[c.terminalOffset(n)+8:]))
+}
+
+func (c *Compact) maxWeight(n uint32) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(c.nodes[int(n)*compactNodeSize+16:]))
+}
+
+func (c *Compact) selections(n uint32) (float64, int64) {
+	base := c.terminalOffset(n)
+	return math.Float64frombits(binary.LittleEndian.Uint64(c.terminals[base+32:])),
+		int64(binary.LittleEndian.Uint64(c.terminals[base+40:]))
+}
+
+func (c *Compact) maxSelections(n uint32) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(c.nodes[int(n)*compactNodeSize+24:]))
+}
+
+func (c *Compact) variants(n uint32) []entry {
+	base := c.terminalOffset(n)
+	first, count := c.u32(c.terminals, base+16), c.u32(c.terminals, base+20)
+	if count == 0 {
+		return nil
+	}
+	variants := make([]entry, count)
+	for i := range variants {
+		offset := int(first)*compactOriginalSize + i*compactOriginalSize
+		variants[i] = entry{c.str(c.originalRanges, offset), c.metaAt(c.originalRanges, offset+8)}
+	}
+	return variants
+}
+
+func (c *Compact) meta(n uint32) interface{} {
+	return c.metaAt(c.terminals, c.terminalOffset(n)+24)
+}
+
+func (c *Compact) starts() (index[uint32], bool) {
+	if !c.wordStarts {
+		return nil, false
+	}
+	return compactStarts{c}, true
+}
+
+// metaAt returns the metadata whose index plus one is stored at offset in section.
+func (c *Compact) metaAt(section []byte, offset int) interface{} {
+	slot := c.u32(section, offset)
+	switch {
+	case slot == 0:
+		return nil
+	case c.codec == nil:
+		return c.metas[slot-1]
+	}
+	if meta := c.decoded[slot-1].Load(); meta != nil {
+		return *meta
+	}
+	base := int(slot-1) * compactRangeSize
+	off, length := c.u32(c.metaRanges, base), c.u32(c.metaRanges, base+4)
+	meta, err := c.codec.DecodeMeta(c.metaData[off : off+length])
+	if err != nil {
+		err = fmt.Errorf("trie: decoding metadata: %w", err)
+		c.metaErr.CompareAndSwap(nil, &err)
+		meta = nil
+	}
+	c.decoded[slot-1].Store(&meta)
+	return meta
+}
@@ -0,0 +1,192 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompact(t *testing.T) {
+	t.Run("Same results as trie", func(t *testing.T) {
+		rnd := rand.New(rand.NewSource(2))
+		letters := []rune("abcdeÉ")
+		tr := New()
+		for i := 0; i < 500; i++ {
+			word := make([]rune, 1+rnd.Intn(7))
+			for j := range word {
+				word[j] = letters[rnd.Intn(len(letters))]
+			}
+			tr.InsertWeighted(string(word), i, float64(rnd.Intn(3)))
+		}
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			query := make([]rune, 1+rnd.Intn(6))
+			for j := range query {
+				query[j] = letters[rnd.Intn(len(letters))]
+			}
+			assert.Equal(t, tr.SearchAllMeta(string(query)), c.SearchAllMeta(string(query)))
+			assert.Equal(t, tr.Search(string(query), 5), c.Search(string(query), 5))
+		}
+	})
+
+	t.Run("FindMeta", func(t *testing.T) {
+		tr := New()
+		tr.InsertWithMeta("Jürgen", "a")
+		tr.Insert("hell", "hello")
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		meta, ok := c.FindMeta("jurgen")
+		assert.True(t, ok)
+		assert.Equal(t, "a", meta)
+		meta, ok = c.FindMeta("hell")
+		assert.True(t, ok)
+		assert.Nil(t, meta)
+		_, ok = c.FindMeta("hel")
+		assert.False(t, ok)
+	})
+
+	t.Run("Settings", func(t *testing.T) {
+		tr := New().WithoutFuzzy().WithoutLevenshtein().CaseSensitive()
+		tr.Insert("Hello")
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		assert.Empty(t, c.SearchAll("hel"))
+		assert.Equal(t, []string{"Hello"}, c.SearchAll("Hel"))
+	})
+
+	t.Run("Open file", func(t *testing.T) {
+		g := NewG[Product]()
+		g.Insert("iPhone", Product{ID: 1, Price: 999})
+		g.Insert("iPad", Product{ID: 2, Price: 799})
+		path := filepath.Join(t.TempDir(), "products.trie")
+		f, err := os.Create(path)
+		assert.NoError(t, err)
+		_, err = g.WriteCompact(f)
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+
+		c, err := OpenCompact(path, TypedGobCodec[Product]{})
+		assert.NoError(t, err)
+		defer c.Close()
+		hits := c.SearchAllMeta("ipho")
+		assert.Equal(t, 1, len(hits))
+		assert.Equal(t, "iPhone", hits[0].Word)
+		assert.Equal(t, Product{ID: 1, Price: 999}, hits[0].Meta)
+	})
+
+	t.Run("Freeze keeps metadata values", func(t *testing.T) {
+		type unregistered struct{ ID int }
+		meta := &unregistered{1}
+		tr := New()
+		tr.InsertWithMeta("hello", meta)
+		tr.InsertWithMeta("help", unregistered{2})
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		found, ok := c.FindMeta("hello")
+		assert.True(t, ok)
+		assert.Same(t, meta, found)
+		assert.Equal(t, unregistered{2}, c.SearchAllMeta("help")[0].Meta)
+	})
+
+	t.Run("Metadata is decoded when read", func(t *testing.T) {
+		g := NewG[Product]()
+		g.Insert("iPhone", Product{ID: 1})
+		g.Insert("iPad", Product{ID: 2})
+		path := filepath.Join(t.TempDir(), "products.trie")
+		f, err := os.Create(path)
+		assert.NoError(t, err)
+		_, err = g.WriteCompact(f)
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+
+		codec := &countingCodec{MetaCodec: TypedGobCodec[Product]{}}
+		c, err := OpenCompact(path, codec)
+		assert.NoError(t, err)
+		defer c.Close()
+		assert.Equal(t, 0, codec.decoded)
+		meta, ok := c.FindMeta("iPad")
+		assert.True(t, ok)
+		assert.Equal(t, Product{ID: 2}, meta)
+		c.FindMeta("iPad")
+		assert.Equal(t, 1, codec.decoded)
+		assert.NoError(t, c.MetaErr())
+	})
+
+	t.Run("Metadata that cannot be decoded", func(t *testing.T) {
+		g := NewG[Product]()
+		g.Insert("iPhone", Product{ID: 1})
+		var buf bytes.Buffer
+		_, err := g.WriteCompact(&buf)
+		assert.NoError(t, err)
+
+		c, err := LoadCompact(buf.Bytes(), TypedGobCodec[string]{})
+		assert.NoError(t, err)
+		assert.NoError(t, c.MetaErr())
+		meta, ok := c.FindMeta("iPhone")
+		assert.True(t, ok)
+		assert.Nil(t, meta)
+		assert.Error(t, c.MetaErr())
+	})
+
+	t.Run("Invalid data", func(t *testing.T) {
+		tr := New()
+		tr.Insert("hello", "help")
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		assert.NotNil(t, c)
+
+		_, err = LoadCompact([]byte("GATCMPCT"), nil)
+		assert.True(t, errors.Is(err, ErrInvalidCompact))
+
+		path := filepath.Join(t.TempDir(), "words.trie")
+		f, err := os.Create(path)
+		assert.NoError(t, err)
+		_, err = tr.WriteCompact(f)
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		_, err = LoadCompact(data[:len(data)-1], nil)
+		assert.True(t, errors.Is(err, ErrInvalidCompact))
+		flags := append([]byte(nil), data...)
+		flags[len(compactMagic)+6] |= 0x10
+		_, err = LoadCompact(flags, nil)
+		assert.True(t, errors.Is(err, ErrInvalidCompact))
+		data[compactHeaderSize+4] = 200
+		_, err = LoadCompact(data, nil)
+		assert.True(t, errors.Is(err, ErrInvalidCompact))
+	})
+}
+
+// countingCodec counts the values it decodes.
+type countingCodec struct {
+	MetaCodec
+	decoded int
+}
+
+func (c *countingCodec) DecodeMeta(data []byte) (interface{}, error) {
+	c.decoded++
+	return c.MetaCodec.DecodeMeta(data)
+}
+
+func BenchmarkCompactSearch(b *testing.B) {
+	t := New()
+	t.Insert("hallo you")
+	c, err := t.Freeze()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	var r []string
+	for n := 0; n < b.N; n++ {
+		r = c.Search("hello", 1)
+	}
+	result = r
+}
@@ -14,7 +14,7 @@ func Example() {
 
 	// Output:
 	// [Wednesday]
-	// [Thursday Tuesday Wednesday]
+	// [Tuesday Thursday Wednesday]
 }
 
 func Example_noFeatures() {
@@ -29,7 +29,7 @@ func Example_noFeatures() {
 
 	// Output:
 	// []
-	// [Thursday Tuesday]
+	// [Tuesday Thursday]
 }
 
 func Example_metadata() {
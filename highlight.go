@@ -0,0 +1,178 @@
+package trie
+
+import (
+	"slices"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Span is the part word[Start:End] of a word, in bytes.
+type Span struct {
+	Start, End int
+}
+
+// Highlight turns highlighting on or off, off by default. With it, the Highlights of every
+// Match hold the parts of Word that the search string matched, so that "jurg" highlights "Jür"
+// in "Jürgen". The search string is matched with the key of Word as in the search, and every
+// character of Word whose key has a matched character is highlighted, together with its
+// combining marks. This holds for the built-in normalisations, which fold every character with
+// no more context than the one before it. A CustomNormaliser that does not, such as one that
+// drops a leading "the ", leaves the matches of the words it changes so without highlights.
+func Highlight(enabled bool) Option {
+	return func(s *settings) error {
+		s.highlight = enabled
+		return nil
+	}
+}
+
+// highlights returns the spans of the word of m that search matched under the settings s.
+func (s *settings) highlights(search string, m Match) []Span {
+	if s.allTerms {
+		return s.termHighlights(search, m.Word)
+	}
+	query, err := s.key(search)
+	if err != nil {
+		return nil
+	}
+	if !m.MidEntry {
+		spans, _ := s.alignSpans(query, m.Word, 0, true, m.Fuzzy)
+		return spans
+	}
+	// the search matched the later word it is closest to
+	var best []Span
+	bestDistance := -1
+	words := wordSpans(m.Word)
+	for i := 1; i < len(words); i++ {
+		start := words[i].Start
+		spans, distance := s.alignSpans(query, m.Word[start:], start, true, m.Fuzzy)
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = spans, distance
+		}
+	}
+	return best
+}
+
+// termHighlights returns the spans of word that the terms of search matched with AllTerms.
+func (s *settings) termHighlights(search, word string) []Span {
+	terms := s.terms(search)
+	keys, words := s.termSpans(word)
+	assignment, _, ok := s.assignTerms(terms, keys, true)
+	if !ok {
+		return nil
+	}
+	var highlights []Span
+	for i, j := range assignment {
+		w := words[j]
+		spans, _ := s.alignSpans(terms[i], word[w.Start:w.End], w.Start, i == len(terms)-1, false)
+		highlights = append(highlights, spans...)
+	}
+	slices.SortFunc(highlights, func(a, b Span) int { return a.Start - b.Start })
+	return highlights
+}
+
+// alignSpans aligns query, a key, with the key of word, or with the prefix of that key closest
+// to it when prefix is set, and returns the spans of word holding the matched characters,
+// moved by offset, and the distance of the alignment. With fuzzy, the alignment may skip the
+// start of the key like a fuzzy search does.
+func (s *settings) alignSpans(query, word string, offset int, prefix, fuzzy bool) ([]Span, int) {
+	key, err := s.key(word)
+	if err != nil {
+		return nil, 0
+	}
+	matched, distance := align([]rune(query), []rune(key), prefix, fuzzy)
+	var spans []Span
+	// done is the number of runes of the key that the part of word before i is folded into.
+	// Each combining sequence adds the runes that the key of it together with the sequence
+	// before it has over the key of that sequence alone, which is as much context as the
+	// normalisations look at, so word is folded a few times over rather than once per rune.
+	// previous is the length of the sequence before i, and before the runes of its own key.
+	// total counts the runes added by every sequence, which add up to the key of word unless a
+	// normaliser looks further than the sequence before, in which case nothing is highlighted.
+	done, previous, before, total := 0, 0, 0, 0
+	for i := 0; i < len(word); {
+		end := i + norm.NFC.NextBoundaryInString(word[i:], true)
+		if end <= i {
+			_, size := utf8.DecodeRuneInString(word[i:])
+			end = i + size
+		}
+		added, alone := 0, 0
+		if c := word[i]; end == i+1 && c < utf8.RuneSelf && s.normaliser == nil && (s.punctuation == PunctuationKept || !isSeparator(rune(c))) {
+			// the built-in normalisations keep any other ASCII character as one character
+			added, alone = 1, 1
+		} else {
+			if k, err := s.key(word[i:end]); err == nil {
+				alone = utf8.RuneCountInString(k)
+			}
+			if k, err := s.key(word[i-previous : end]); err == nil {
+				added = max(0, utf8.RuneCountInString(k)-before)
+			}
+		}
+		folded := min(done+added, len(matched))
+		total += added
+		if slices.Contains(matched[done:max(done, folded)], true) {
+			if n := len(spans); n > 0 && spans[n-1].End == offset+i {
+				spans[n-1].End = offset + end
+			} else {
+				spans = append(spans, Span{offset + i, offset + end})
+			}
+		}
+		done, previous, before = max(done, folded), end-i, alone
+		i = end
+	}
+	if total != len(matched) {
+		return nil, distance
+	}
+	return spans, distance
+}
+
+// align returns which runes of key are matched by a rune of query in an alignment with the
+// lowest levenshtein distance, and the distance. With prefix, query is aligned with the prefix
+// of key it is closest to, and with fuzzy, the start of key may be skipped at no cost.
+func align(query, key []rune, prefix, fuzzy bool) ([]bool, int) {
+	// d[i][j] is the distance between query[:i] and key[:j]
+	d := make([][]int, len(query)+1)
+	for i := range d {
+		d[i] = make([]int, len(key)+1)
+		d[i][0] = i
+	}
+	for j := 1; j <= len(key); j++ {
+		if !fuzzy {
+			d[0][j] = j
+		}
+	}
+	for i := 1; i <= len(query); i++ {
+		for j := 1; j <= len(key); j++ {
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+substitution(query[i-1], key[j-1]))
+		}
+	}
+	end := len(key)
+	if prefix {
+		end = 0
+		for j := range d[len(query)] {
+			if d[len(query)][j] < d[len(query)][end] {
+				end = j
+			}
+		}
+	}
+	matched := make([]bool, len(key))
+	for i, j := len(query), end; i > 0 && j > 0; {
+		switch {
+		case d[i][j] == d[i-1][j-1]+substitution(query[i-1], key[j-1]):
+			matched[j-1] = query[i-1] == key[j-1]
+			i, j = i-1, j-1
+		case d[i][j] == d[i-1][j]+1:
+			i--
+		default:
+			j--
+		}
+	}
+	return matched, d[len(query)][end]
+}
+
+func substitution(a, b rune) int {
+	if a == b {
+		return 0
+	}
+	return 1
+}
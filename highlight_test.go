@@ -0,0 +1,100 @@
+package trie
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighlight(t *testing.T) {
+	// highlighted returns the highlighted parts of the words of matches.
+	highlighted := func(matches []Match) [][]string {
+		res := make([][]string, len(matches))
+		for i, m := range matches {
+			for _, span := range m.Highlights {
+				res[i] = append(res[i], m.Word[span.Start:span.End])
+			}
+		}
+		return res
+	}
+
+	t.Run("Off by default", func(t *testing.T) {
+		tr := New()
+		tr.Insert("Jürgen")
+		assert.Nil(t, tr.SearchAllMeta("jurg")[0].Highlights)
+	})
+
+	t.Run("Normalised and case folded", func(t *testing.T) {
+		tr := New()
+		tr.Insert("Jürgen", "Straße", "ΣΟΦΟΣ")
+		assert.Equal(t, []Span{{0, 5}}, tr.SearchAllMeta("jurg", Highlight(true))[0].Highlights)
+		assert.Equal(t, [][]string{{"Stra"}}, highlighted(tr.SearchAllMeta("stra", Highlight(true))))
+		assert.Equal(t, [][]string{{"Straß"}}, highlighted(tr.SearchAllMeta("strass", Highlight(true))))
+		assert.Equal(t, [][]string{{"ΣΟΦ"}}, highlighted(tr.SearchAllMeta("σοφ", Highlight(true))))
+		// a letter is highlighted together with its combining marks
+		marks := New()
+		marks.Insert("Jo\u0308rg")
+		assert.Equal(t, [][]string{{"Jo\u0308r"}}, highlighted(marks.SearchAllMeta("jor", Highlight(true))))
+	})
+
+	t.Run("Typos and fuzzy matches", func(t *testing.T) {
+		tr, err := NewWithOptions(Highlight(true))
+		assert.NoError(t, err)
+		tr.Insert("Jürgen")
+		assert.Equal(t, [][]string{{"J", "rgen"}}, highlighted(tr.SearchAllMeta("jxrgen", Fuzzy(false))))
+
+		fuzzy, err := NewWithOptions(Highlight(true), Levenshtein(map[uint8]uint8{0: 0}))
+		assert.NoError(t, err)
+		fuzzy.Insert("Wonderland")
+		assert.Equal(t, [][]string{{"der"}}, highlighted(fuzzy.SearchAllMeta("der")))
+	})
+
+	t.Run("Compatibility and punctuation", func(t *testing.T) {
+		tr, err := NewWithOptions(Highlight(true), Compatibility(true), Punctuation(PunctuationStripped))
+		assert.NoError(t, err)
+		tr.Insert("ｉＰｈｏｎｅ", "Wi-Fi")
+		assert.Equal(t, [][]string{{"ｉＰｈ"}}, highlighted(tr.SearchAllMeta("iph")))
+		assert.Equal(t, [][]string{{"Wi", "F"}}, highlighted(tr.SearchAllMeta("wif")))
+	})
+
+	t.Run("Custom normalisers", func(t *testing.T) {
+		tr, err := NewWithOptions(Highlight(true), CustomNormaliser(LowerCase))
+		assert.NoError(t, err)
+		tr.Insert("Beatles")
+		assert.Equal(t, [][]string{{"Bea"}}, highlighted(tr.SearchAllMeta("bea")))
+
+		// the key of "The" alone is not where "The Beatles" starts its key
+		article := NormaliserFunc(func(word string) (string, error) {
+			return strings.TrimPrefix(strings.ToLower(word), "the "), nil
+		})
+		tr, err = NewWithOptions(Highlight(true), CustomNormaliser(article))
+		assert.NoError(t, err)
+		tr.Insert("The Beatles")
+		matches := tr.SearchAllMeta("bea")
+		assert.Equal(t, 1, len(matches))
+		assert.Empty(t, matches[0].Highlights)
+	})
+
+	t.Run("Word starts and terms", func(t *testing.T) {
+		tr, err := NewWithOptions(Highlight(true), WordStarts(true))
+		assert.NoError(t, err)
+		tr.Insert("New York New", "Apple Red Delicious")
+		assert.Equal(t, []Span{{4, 7}}, tr.SearchAllMeta("yor")[0].Highlights)
+		assert.Equal(t, [][]string{{"Ap", "Red"}}, highlighted(tr.SearchAllMeta("red ap", AllTerms(true))))
+	})
+
+	t.Run("Stricter queries and compact indexes", func(t *testing.T) {
+		tr, err := NewWithOptions(Highlight(true))
+		assert.NoError(t, err)
+		tr.Insert("Jürgen", "jurgen")
+		assert.Equal(t, [][]string{{"Jür"}}, highlighted(tr.SearchAllMeta("Jür", Normalisation(false), CaseSensitivity(true))))
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		assert.Equal(t, tr.SearchAllMeta("jur"), c.SearchAllMeta("jur"))
+
+		g := NewG[int]()
+		g.Insert("Jürgen", 1)
+		assert.Equal(t, []Span{{0, 3}}, g.SearchAll("jü", Highlight(true))[0].Highlights)
+	})
+}
@@ -0,0 +1,106 @@
+package trie
+
+import (
+	"iter"
+	"slices"
+	"strings"
+)
+
+// prefixEntries returns an iterator over the entries of idx whose keys start with the key of
+// prefix, ordered by their keys and then by their original forms. It walks idx as it yields
+// them, so idx must not change until the iteration is done.
+func prefixEntries[N any](idx index[N], s *settings, prefix string) iter.Seq2[string, interface{}] {
+	return func(yield func(string, interface{}) bool) {
+		prefix, err := s.key(prefix)
+		if err != nil {
+			return
+		}
+		n, ok := idx.root(), true
+		for _, r := range prefix {
+			if n, ok = idx.child(n, r); !ok {
+				return
+			}
+		}
+		var entries []entry
+		var edges []edge[N]
+		stack := []N{n}
+		for len(stack) > 0 {
+			n = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if idx.terminal(n) {
+				entries = append(entries[:0], idx.variants(n)...)
+				if len(entries) == 0 {
+					entries = append(entries, entry{idx.word(n), idx.meta(n)})
+				}
+				slices.SortFunc(entries, func(a, b entry) int { return strings.Compare(a.word, b.word) })
+				for _, e := range entries {
+					if !yield(e.word, e.meta) {
+						return
+					}
+				}
+			}
+			// push the children in reverse, so that the lowest rune is visited first
+			edges = idx.appendChildren(edges[:0], n, true)
+			for i := len(edges) - 1; i >= 0; i-- {
+				stack = append(stack, edges[i].node)
+			}
+		}
+	}
+}
+
+// All returns an iterator over the words in the trie, as they were inserted, and their
+// metadata. See WithPrefix for the order.
+func (t *Trie) All() iter.Seq2[string, interface{}] {
+	return t.WithPrefix("")
+}
+
+// WithPrefix returns an iterator over the words starting with prefix, as they were inserted,
+// and their metadata. The prefix is normalised like a search, and the words are ordered by
+// their normalised form and then by their original form, so "Jürgen" and "jurgen" are next
+// to each other. The iterator yields the words the trie held when WithPrefix was called,
+// and the trie may be changed while iterating. The words are found as they are yielded, from
+// nodes the trie copies before changing them from then on.
+func (t *Trie) WithPrefix(prefix string) iter.Seq2[string, interface{}] {
+	snapshot := t.snapshot()
+	return prefixEntries[*node](trieIndex{snapshot}, &snapshot.settings, prefix)
+}
+
+// All returns an iterator over the words in the index and their metadata, exactly like Trie.All.
+func (c *Compact) All() iter.Seq2[string, interface{}] {
+	return c.WithPrefix("")
+}
+
+// WithPrefix returns an iterator over the words starting with prefix and their metadata,
+// exactly like Trie.WithPrefix.
+func (c *Compact) WithPrefix(prefix string) iter.Seq2[string, interface{}] {
+	return prefixEntries[uint32](c, &c.settings, prefix)
+}
+
+// All returns an iterator over the words in the current snapshot and their metadata.
+func (p *Persistent) All() iter.Seq2[string, interface{}] {
+	return p.Snapshot().All()
+}
+
+// WithPrefix returns an iterator over the words starting with prefix in the current snapshot
+// and their metadata.
+func (p *Persistent) WithPrefix(prefix string) iter.Seq2[string, interface{}] {
+	return p.Snapshot().WithPrefix(prefix)
+}
+
+// All returns an iterator over the words in the trie and their typed metadata.
+func (g *GTrie[T]) All() iter.Seq2[string, T] {
+	return g.WithPrefix("")
+}
+
+// WithPrefix returns an iterator over the words starting with prefix and their typed metadata.
+func (g *GTrie[T]) WithPrefix(prefix string) iter.Seq2[string, T] {
+	entries := g.Trie.WithPrefix(prefix)
+	return func(yield func(string, T) bool) {
+		for word, meta := range entries {
+			v, _ := meta.(T)
+			if !yield(word, v) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package trie
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIterators(t *testing.T) {
+	words := func(seq func(func(string, interface{}) bool)) []string {
+		var res []string
+		for word := range seq {
+			res = append(res, word)
+		}
+		return res
+	}
+
+	t.Run("All in order", func(t *testing.T) {
+		tr := New()
+		tr.InsertWithMeta("jurgen", 1)
+		tr.Insert("Zebra", "apple", "Jürgen", "app", "ápple")
+		tr.InsertWithMeta("banana", 2)
+		assert.Equal(t, []string{"app", "apple", "ápple", "banana", "Jürgen", "jurgen", "Zebra"}, words(tr.All()))
+		meta := maps.Collect(tr.All())
+		assert.Equal(t, 2, meta["banana"])
+		assert.Nil(t, meta["Zebra"])
+	})
+
+	t.Run("WithPrefix", func(t *testing.T) {
+		tr := New()
+		tr.Insert("hello", "Help", "hell", "world")
+		assert.Equal(t, []string{"hell", "hello", "Help"}, words(tr.WithPrefix("HEL")))
+		assert.Equal(t, []string{"hell", "hello"}, words(tr.WithPrefix("hell")))
+		assert.Empty(t, words(tr.WithPrefix("helo")))
+	})
+
+	t.Run("Early stop and changes while iterating", func(t *testing.T) {
+		tr := New()
+		tr.Insert("a", "b", "c")
+		var seen []string
+		for word := range tr.All() {
+			seen = append(seen, word)
+			tr.Delete(word)
+			if word == "b" {
+				break
+			}
+		}
+		assert.Equal(t, []string{"a", "b"}, seen)
+		assert.Equal(t, []string{"c"}, words(tr.All()))
+	})
+
+	t.Run("Iterating a trie that is changed concurrently", func(t *testing.T) {
+		tr := New()
+		tr.Insert("a", "ab", "abc")
+		seq := tr.WithPrefix("a")
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				tr.Insert(fmt.Sprintf("ab%d", i))
+				tr.Delete("abc")
+			}
+		}()
+		assert.Equal(t, []string{"a", "ab", "abc"}, words(seq))
+		<-done
+		assert.Len(t, words(tr.All()), 102)
+	})
+
+	t.Run("Iterating inside a filter", func(t *testing.T) {
+		tr := New()
+		tr.InsertWithMeta("apple", 1)
+		tr.InsertWithMeta("apricot", 2)
+		keep := Filter(func(meta int) bool { return len(words(tr.All())) == meta })
+		assert.Equal(t, []string{"apricot"}, tr.SearchAll("ap", keep))
+	})
+
+	t.Run("Changes copy nodes only after an iterator", func(t *testing.T) {
+		tr := New()
+		tr.Insert("a", "b")
+		gen := tr.gen
+		tr.Insert("c")
+		assert.Equal(t, gen, tr.gen)
+		seq := tr.All()
+		tr.Insert("d")
+		tr.Insert("e")
+		assert.Equal(t, gen+1, tr.gen)
+		assert.Equal(t, []string{"a", "b", "c"}, words(seq))
+	})
+
+	t.Run("Compact and Persistent", func(t *testing.T) {
+		tr := New()
+		tr.Insert("hello", "Help", "Jürgen", "jurgen")
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		assert.Equal(t, words(tr.All()), words(c.All()))
+		assert.Equal(t, words(tr.WithPrefix("he")), words(c.WithPrefix("he")))
+
+		p := NewPersistent()
+		p.Insert("hello", "Help", "Jürgen", "jurgen")
+		assert.Equal(t, words(tr.All()), words(p.All()))
+		assert.Equal(t, []string{"Jürgen", "jurgen"}, words(p.WithPrefix("jur")))
+	})
+
+	t.Run("Generic", func(t *testing.T) {
+		g := NewG[Product]()
+		g.Insert("iPhone", Product{ID: 1, Price: 999})
+		g.Insert("iPad", Product{ID: 2, Price: 799})
+		g.Insert("Mac", Product{ID: 3, Price: 1299})
+		var ids []int
+		for word, p := range g.WithPrefix("ip") {
+			assert.True(t, slices.Contains([]string{"iPad", "iPhone"}, word))
+			ids = append(ids, p.ID)
+		}
+		assert.Equal(t, []int{2, 1}, ids)
+		assert.Equal(t, 3, len(maps.Collect(g.All())))
+	})
+}
+
+func BenchmarkAll(b *testing.B) {
+	t := New()
+	t.Insert("Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for range t.All() {
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package trie
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -57,6 +58,45 @@ func TestMetadataFunctions(t *testing.T) {
 		assert.Empty(t, tr.SearchAllMeta("ipad"))
 	})
 
+	t.Run("Delete a single variant", func(t *testing.T) {
+		tr := New()
+		tr.InsertWithMeta("Jürgen", 1)
+		tr.InsertWithMeta("Jurgen", 2)
+		tr.InsertWithMeta("JURGEN", 3)
+		assert.False(t, tr.Delete("jurgen"))
+		assert.True(t, tr.Delete("Jurgen"))
+		assert.False(t, tr.Delete("Jurgen"))
+		assert.Equal(t, []Match{{Word: "Jürgen", Meta: 1}, {Word: "JURGEN", Meta: 3}}, tr.SearchAllMeta("jur"))
+		meta, ok := tr.FindMeta("Jurgen")
+		assert.True(t, ok)
+		assert.Equal(t, 3, meta)
+
+		assert.True(t, tr.Delete("JURGEN"))
+		assert.True(t, tr.Delete("Jürgen"))
+		_, ok = tr.FindMeta("jurgen")
+		assert.False(t, ok)
+		assert.Empty(t, tr.SearchAll("jur"))
+	})
+
+	t.Run("Delete all variants", func(t *testing.T) {
+		tr := New()
+		tr.InsertWithMeta("Jürgen", 1)
+		tr.InsertWithMeta("Jurgen", 2)
+		tr.Insert("Julia")
+		assert.False(t, tr.DeleteAll("jurg"))
+		assert.True(t, tr.DeleteAll("jurgen"))
+		assert.False(t, tr.DeleteAll("jurgen"))
+		assert.Equal(t, []string{"Julia"}, tr.SearchAll("ju"))
+	})
+
+	t.Run("Delete without variants", func(t *testing.T) {
+		tr := New().CaseSensitive().WithoutNormalisation()
+		tr.Insert("Hello", "hello")
+		assert.True(t, tr.Delete("Hello"))
+		assert.False(t, tr.Delete("Hello"))
+		assert.Equal(t, []string{"hello"}, tr.SearchAll("hel"))
+	})
+
 	t.Run("Fuzzy collisions", func(t *testing.T) {
 		tr := New()
 		tr.InsertWithMeta("iPhone", "A")
@@ -67,4 +107,136 @@ func TestMetadataFunctions(t *testing.T) {
 		assert.Equal(t, "A", m["iPhone"])
 		assert.Equal(t, "B", m["iPhobe"])
 	})
+
+	t.Run("Match details", func(t *testing.T) {
+		tr := New()
+		tr.InsertWithMeta("hello", 1)
+		tr.InsertWithMeta("help", 2)
+		hits := tr.SearchAllMeta("hello")
+		assert.Equal(t, []Match{
+			{Word: "hello", Meta: 1, Distance: 0, Exact: true},
+			{Word: "help", Meta: 2, Distance: 2, Exact: true},
+		}, hits)
+
+		hits = tr.SearchAllMeta("hel")
+		assert.Equal(t, 2, len(hits))
+		assert.False(t, hits[0].Exact)
+		assert.Equal(t, 0, hits[0].Distance)
+
+		hits = tr.SearchAllMeta("llo")
+		assert.Equal(t, []Match{{Word: "hello", Meta: 1, Distance: 0, Fuzzy: true, Exact: true}}, hits)
+	})
+
+	t.Run("Generic match details", func(t *testing.T) {
+		g := NewG[Product]()
+		g.Insert("iPhone", Product{ID: 1})
+		res := g.SearchAll("iphome")
+		assert.Equal(t, []GMatch[Product]{{Word: "iPhone", Meta: Product{ID: 1}, Distance: 1, Exact: true}}, res)
+	})
+
+	t.Run("Metadata per variant", func(t *testing.T) {
+		tr := New()
+		tr.InsertWithMeta("iPhone", 1)
+		tr.InsertWithMeta("iphone", 2)
+		tr.InsertWithMeta("IPHONE", 3)
+		tr.InsertWithMeta("iPhone", 4)
+		hits := tr.SearchAllMeta("iph")
+		assert.Equal(t, []Match{{Word: "iphone", Meta: 2}, {Word: "iPhone", Meta: 4}, {Word: "IPHONE", Meta: 3}}, hits)
+
+		meta, ok := tr.FindMeta("iphone")
+		assert.True(t, ok)
+		assert.Equal(t, 2, meta)
+		// without an exact variant the last insert wins
+		meta, ok = tr.FindMeta("Iphone")
+		assert.True(t, ok)
+		assert.Equal(t, 4, meta)
+
+		var buf bytes.Buffer
+		_, err := tr.WriteTo(&buf)
+		assert.NoError(t, err)
+		loaded := New()
+		_, err = loaded.ReadFrom(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, hits, loaded.SearchAllMeta("iph"))
+
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		assert.Equal(t, hits, c.SearchAllMeta("iph"))
+		meta, ok = c.FindMeta("IPHONE")
+		assert.True(t, ok)
+		assert.Equal(t, 3, meta)
+	})
+
+	t.Run("Generic metadata per variant", func(t *testing.T) {
+		g := NewG[Product]()
+		g.Insert("Café", Product{ID: 1})
+		g.Insert("cafe", Product{ID: 2})
+		res := g.SearchAll("caf")
+		assert.Equal(t, []GMatch[Product]{{Word: "cafe", Meta: Product{ID: 2}}, {Word: "Café", Meta: Product{ID: 1}}}, res)
+		p, ok := g.Find("Café")
+		assert.True(t, ok)
+		assert.Equal(t, 1, p.ID)
+	})
+}
+
+func TestFilter(t *testing.T) {
+	inStock := Filter(func(p Product) bool { return p.Price > 0 })
+
+	t.Run("Limits count the kept words", func(t *testing.T) {
+		g := NewG[Product]()
+		for i, name := range []string{"iPad", "iPad Air", "iPad Mini", "iPad Pro", "iPhone"} {
+			g.InsertWeighted(name, Product{ID: i, Price: float64(i % 2)}, float64(10-i))
+		}
+		assert.Equal(t, []string{"iPad Air", "iPad Pro"}, g.Search("ip", 2, inStock))
+		assert.Equal(t, []string{"iPad", "iPad Air"}, g.Search("ip", 2))
+		var ids []int
+		for _, m := range g.SearchAll("ipad", inStock) {
+			ids = append(ids, m.Meta.ID)
+		}
+		assert.Equal(t, []int{1, 3}, ids)
+	})
+
+	t.Run("Variants", func(t *testing.T) {
+		g := NewG[Product]()
+		g.Insert("Café", Product{ID: 1})
+		g.Insert("cafe", Product{ID: 2, Price: 3})
+		assert.Equal(t, []GMatch[Product]{{Word: "cafe", Meta: Product{ID: 2, Price: 3}}}, g.SearchAll("caf", inStock))
+	})
+
+	t.Run("Left out forms are not typed as searched", func(t *testing.T) {
+		even := Filter(func(n int) bool { return n%2 == 0 })
+		tr := New().WithoutLevenshtein()
+		tr.InsertWithMeta("Appa", 1)
+		tr.InsertWithMeta("appa", 2)
+		tr.InsertWithMeta("Appb", 2)
+		all := tr.SearchAll("App", even)
+		assert.Equal(t, []string{"Appb", "appa"}, all)
+		assert.Equal(t, all[:1], tr.Search("App", 1, even))
+	})
+
+	t.Run("Untyped and missing metadata", func(t *testing.T) {
+		tr := New()
+		tr.InsertWithMeta("de-DE", "de")
+		tr.InsertWithMeta("de-AT", "at")
+		tr.Insert("dessert")
+		tr.InsertWithMeta("delta", 4)
+		assert.Equal(t, []string{"de-DE"}, tr.SearchAll("de", Filter(func(locale string) bool { return locale == "de" })))
+		assert.Equal(t, []string{"dessert"}, tr.SearchAll("de", Filter(func(meta interface{}) bool { return meta == nil })))
+		assert.Equal(t, 4, len(tr.SearchAll("de", Filter[string](nil))))
+	})
+
+	t.Run("Other searches", func(t *testing.T) {
+		tr, err := NewWithOptions(WordStarts(true))
+		assert.NoError(t, err)
+		tr.WithMetaCodec(TypedGobCodec[Product]{})
+		tr.InsertWithMeta("New York", Product{ID: 1})
+		tr.InsertWithMeta("York", Product{ID: 2})
+		tr.InsertWithMeta("Old York", Product{ID: 3, Price: 1})
+		assert.Equal(t, []string{"Old York"}, tr.Search("york", 1, inStock))
+		assert.Equal(t, []string{"Old York"}, tr.SearchAll("york old", inStock, AllTerms(true)))
+		assert.Equal(t, []string{"Old York"}, tr.SearchAll("York", inStock, CaseSensitivity(true)))
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Old York"}, c.SearchAll("york", inStock))
+	})
 }
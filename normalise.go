@@ -0,0 +1,339 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// ErrMissingNormaliser is returned when a snapshot or compact index built with a custom
+// normaliser is read without one.
+var ErrMissingNormaliser = errors.New("trie: index was built with a custom normaliser")
+
+// Normaliser turns a word into the key under which it is indexed, and a search string into
+// the key that is matched against them. Words with the same key are found by the same
+// searches. A Normaliser must be safe for concurrent use.
+type Normaliser interface {
+	Normalise(word string) (string, error)
+}
+
+// NormaliserFunc adapts a function to a Normaliser.
+type NormaliserFunc func(word string) (string, error)
+
+// Normalise calls f(word).
+func (f NormaliserFunc) Normalise(word string) (string, error) { return f(word) }
+
+var (
+	// StripAccents removes accents and other combining marks, so that "Jürgen" becomes "Jurgen".
+	// It is the normalisation of a trie WithNormalisation.
+	StripAccents Normaliser = NormaliserFunc(stripAccents)
+	// LowerCase maps every letter to lower case with strings.ToLower. Unlike FoldCase it
+	// keeps "ß" apart from "ss" and "ς" apart from "σ".
+	LowerCase Normaliser = NormaliserFunc(func(word string) (string, error) {
+		return strings.ToLower(word), nil
+	})
+)
+
+// FoldCompatibility replaces compatibility characters with their plain forms by NFKC
+// normalisation and width folding, so that full-width "ｉＰｈｏｎｅ" becomes "iPhone", "ﬁ" becomes
+// "fi", "²" becomes "2" and "①" becomes "1". It is the normalisation of the Compatibility option.
+var FoldCompatibility Normaliser = NormaliserFunc(foldCompatibility)
+
+func foldCompatibility(word string) (string, error) {
+	folded, _, err := transform.String(transform.Chain(norm.NFKC, width.Fold), word)
+	if err != nil {
+		return "", err
+	}
+	return folded, nil
+}
+
+// Compatibility turns compatibility normalisation on or off, which makes words match
+// whatever the width of their characters or the ligatures, superscripts and other
+// compatibility forms they are written with. It is off by default, and only applies to a
+// whole trie, set with NewWithOptions or Reconfigure, and not to a single search.
+func Compatibility(enabled bool) Option {
+	return func(s *settings) error {
+		s.compatible = enabled
+		return nil
+	}
+}
+
+// PunctuationMode decides how whitespace and punctuation count in keys.
+type PunctuationMode uint8
+
+const (
+	// PunctuationKept matches whitespace and punctuation like any other character.
+	PunctuationKept PunctuationMode = iota
+	// PunctuationCollapsed turns every run of whitespace and punctuation into a single space,
+	// so that "e-mail" and "e mail" match, but "email" does not.
+	PunctuationCollapsed
+	// PunctuationStripped removes whitespace and punctuation, so that "e-mail", "e mail" and
+	// "email" all match.
+	PunctuationStripped
+)
+
+// Punctuation sets how whitespace and punctuation count in keys, PunctuationKept by default.
+// It only applies to a whole trie, set with NewWithOptions or Reconfigure, and not to a
+// single search.
+func Punctuation(mode PunctuationMode) Option {
+	return func(s *settings) error {
+		if mode > PunctuationStripped {
+			return fmt.Errorf("trie: invalid punctuation mode %d", mode)
+		}
+		s.punctuation = mode
+		return nil
+	}
+}
+
+var (
+	// StripPunctuation removes whitespace and punctuation. It is the normalisation of
+	// PunctuationStripped.
+	StripPunctuation Normaliser = NormaliserFunc(func(word string) (string, error) {
+		return stripPunctuation(word), nil
+	})
+	// CollapsePunctuation turns every run of whitespace and punctuation into a single space
+	// and removes it from the start. It is the normalisation of PunctuationCollapsed.
+	CollapsePunctuation Normaliser = NormaliserFunc(func(word string) (string, error) {
+		return collapsePunctuation(word), nil
+	})
+)
+
+func isSeparator(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsPunct(r)
+}
+
+func stripPunctuation(word string) string {
+	return strings.Map(func(r rune) rune {
+		if isSeparator(r) {
+			return -1
+		}
+		return r
+	}, word)
+}
+
+// collapsePunctuation keeps a separator at the end, so that a search for "t-" only finds
+// words that go on after the separator.
+func collapsePunctuation(word string) string {
+	var b strings.Builder
+	b.Grow(len(word))
+	separated := false
+	for _, r := range word {
+		if isSeparator(r) {
+			separated = b.Len() > 0
+			continue
+		}
+		if separated {
+			b.WriteByte(' ')
+			separated = false
+		}
+		b.WriteRune(r)
+	}
+	if separated {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// FoldCase returns a Normaliser applying full Unicode case folding, so that "STRASSE" and
+// "straße" or "ΣΟΦΟΣ" and "σοφος" have the same key. With a language other than
+// language.Und, the letters are lower cased by the rules of that language first, which
+// tells the Turkish dotted "İ" from the dotless "I". FoldCase(language.Und) is the case
+// folding of a CaseInsensitive trie.
+func FoldCase(tag language.Tag) Normaliser {
+	return NormaliserFunc(func(word string) (string, error) {
+		return foldCase(word, tag), nil
+	})
+}
+
+func foldCase(word string, tag language.Tag) string {
+	if tag != language.Und {
+		word = cases.Lower(tag).String(word)
+	}
+	return cases.Fold().String(word)
+}
+
+// Language sets the language whose casing rules a case insensitive trie uses, such as
+// language.Turkish. It only applies to a whole trie, set with NewWithOptions or Reconfigure,
+// and not to a single search.
+func Language(tag language.Tag) Option {
+	return func(s *settings) error {
+		s.language = tag
+		return nil
+	}
+}
+
+func stripAccents(word string) (string, error) {
+	transformer := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	normal, _, err := transform.String(transformer, word)
+	if err != nil {
+		return "", err
+	}
+	return normal, nil
+}
+
+// Chain returns a Normaliser that applies the normalisers in order.
+func Chain(normalisers ...Normaliser) Normaliser {
+	return NormaliserFunc(func(word string) (string, error) {
+		for _, n := range normalisers {
+			var err error
+			if word, err = n.Normalise(word); err != nil {
+				return "", err
+			}
+		}
+		return word, nil
+	})
+}
+
+// CustomNormaliser makes n produce the keys of words and search strings, in place of the
+// normalisation and case folding chosen by Normalisation, CaseSensitivity, Compatibility,
+// Language and Punctuation, which then have no effect. A custom normaliser can only be set for
+// a whole trie, with NewWithOptions or Reconfigure, and not for a single search.
+//
+// Snapshots and compact indexes do not contain the normaliser. A trie reading a snapshot
+// must already use the same normaliser, and LoadCompact and OpenCompact need it as an option.
+//
+// For example, to fold "æ" to "ae" on top of the default normalisation, folding the case
+// first so that "Æ" is folded too:
+//
+//	trie.CustomNormaliser(trie.Chain(
+//		trie.FoldCase(language.Und),
+//		trie.NormaliserFunc(func(w string) (string, error) { return strings.ReplaceAll(w, "æ", "ae"), nil }),
+//		trie.StripAccents,
+//	))
+func CustomNormaliser(n Normaliser) Option {
+	return func(s *settings) error {
+		s.normaliser = n
+		return nil
+	}
+}
+
+// key returns the form under which word is indexed and searched. Compatibility forms are
+// replaced first, so that the other steps see the plain characters, and case is folded before
+// accents are stripped, as some casing rules depend on the accents.
+func (s *settings) key(word string) (string, error) {
+	if s.normaliser != nil {
+		return s.normaliser.Normalise(word)
+	}
+	if s.compatible {
+		var err error
+		if word, err = foldCompatibility(word); err != nil {
+			return "", err
+		}
+	}
+	if !s.caseSensitive {
+		word = foldCase(word, s.language)
+	}
+	if s.normalised {
+		var err error
+		if word, err = stripAccents(word); err != nil {
+			return "", err
+		}
+	}
+	switch s.punctuation {
+	case PunctuationCollapsed:
+		word = collapsePunctuation(word)
+	case PunctuationStripped:
+		word = stripPunctuation(word)
+	}
+	return word, nil
+}
+
+// keepsOriginals reports whether keys can differ from the words they were made from, so that
+// the original words have to be remembered.
+func (s *settings) keepsOriginals() bool {
+	return s.normaliser != nil || s.compatible || s.punctuation != PunctuationKept || s.normalised || !s.caseSensitive
+}
+
+// flags returns the flag* bits of the settings stored in snapshots and compact indexes.
+func (s *settings) flags() uint32 {
+	var flags uint32
+	if s.fuzzy {
+		flags |= flagFuzzy
+	}
+	if s.normalised {
+		flags |= flagNormalised
+	}
+	if s.caseSensitive {
+		flags |= flagCaseSensitive
+	}
+	if s.normaliser != nil {
+		flags |= flagCustomNormaliser
+	}
+	if s.compatible {
+		flags |= flagCompatible
+	}
+	if s.wordStarts {
+		flags |= flagWordStarts
+	}
+	if s.allTerms {
+		flags |= flagAllTerms
+	}
+	if s.highlight {
+		flags |= flagHighlight
+	}
+	switch s.punctuation {
+	case PunctuationCollapsed:
+		flags |= flagPunctuationCollapsed
+	case PunctuationStripped:
+		flags |= flagPunctuationStripped
+	}
+	return flags
+}
+
+// languageString returns the tag as stored in snapshots and compact indexes.
+func languageString(tag language.Tag) string {
+	if tag == language.Und {
+		return ""
+	}
+	return tag.String()
+}
+
+// parseLanguage parses a tag stored by languageString.
+func parseLanguage(s string) (language.Tag, error) {
+	if s == "" {
+		return language.Und, nil
+	}
+	return language.Parse(s)
+}
+
+// setFlags restores the settings stored as flag* bits. A custom normaliser must already be set
+// when the flags call for one, and is removed when they do not. Bits it does not know, and
+// more than one punctuation mode, are an error wrapping invalid, the error of the format the
+// flags were read from. s is left unchanged on an error.
+func (s *settings) setFlags(flags uint32, invalid error) error {
+	if unknown := flags &^ knownFlags; unknown != 0 {
+		return fmt.Errorf("%w: unknown flags %#x", invalid, unknown)
+	}
+	if flags&flagPunctuationCollapsed != 0 && flags&flagPunctuationStripped != 0 {
+		return fmt.Errorf("%w: more than one punctuation mode", invalid)
+	}
+	if flags&flagCustomNormaliser == 0 {
+		s.normaliser = nil
+	} else if s.normaliser == nil {
+		return ErrMissingNormaliser
+	}
+	s.fuzzy = flags&flagFuzzy != 0
+	s.normalised = flags&flagNormalised != 0
+	s.caseSensitive = flags&flagCaseSensitive != 0
+	s.compatible = flags&flagCompatible != 0
+	s.wordStarts = flags&flagWordStarts != 0
+	s.allTerms = flags&flagAllTerms != 0
+	s.highlight = flags&flagHighlight != 0
+	switch {
+	case flags&flagPunctuationStripped != 0:
+		s.punctuation = PunctuationStripped
+	case flags&flagPunctuationCollapsed != 0:
+		s.punctuation = PunctuationCollapsed
+	default:
+		s.punctuation = PunctuationKept
+	}
+	return nil
+}
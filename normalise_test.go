@@ -0,0 +1,343 @@
+package trie
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+// ligatureFolding expands the ligatures æ and œ on top of the default normalisation.
+var ligatureFolding = Chain(
+	NormaliserFunc(func(word string) (string, error) {
+		return strings.NewReplacer("æ", "ae", "Æ", "AE", "œ", "oe", "Œ", "OE").Replace(word), nil
+	}),
+	FoldCase(language.Und),
+	StripAccents,
+)
+
+func TestNormaliser(t *testing.T) {
+	exact := []Option{Fuzzy(false), Levenshtein(map[uint8]uint8{0: 0})}
+
+	t.Run("Default", func(t *testing.T) {
+		for word, key := range map[string]string{"Jürgen": "jurgen", "ÆSIR": "æsir", "Straße": "strasse", "ΣΟΦΟΣ": "σοφοσ"} {
+			normal, err := Chain(FoldCase(language.Und), StripAccents).Normalise(word)
+			assert.NoError(t, err)
+			assert.Equal(t, key, normal)
+			normal, err = New().key(word)
+			assert.NoError(t, err)
+			assert.Equal(t, key, normal)
+		}
+	})
+
+	t.Run("Custom folding", func(t *testing.T) {
+		tr, err := NewWithOptions(append(exact, CustomNormaliser(ligatureFolding))...)
+		assert.NoError(t, err)
+		tr.InsertWithMeta("Cæsar", 1)
+		tr.InsertWithMeta("CAESAR", 2)
+		tr.Insert("Œuvre")
+		assert.Equal(t, []Match{{Word: "Cæsar", Meta: 1}, {Word: "CAESAR", Meta: 2}}, tr.SearchAllMeta("caes"))
+		assert.Equal(t, []string{"Œuvre"}, tr.SearchAll("oeu"))
+		meta, ok := tr.FindMeta("caesar")
+		assert.True(t, ok)
+		assert.Equal(t, 2, meta)
+		assert.True(t, tr.Delete("Cæsar"))
+		assert.Equal(t, []string{"CAESAR"}, tr.SearchAll("cæs"))
+		// a query cannot replace or bypass the normaliser
+		assert.Equal(t, []string{"CAESAR"}, tr.SearchAll("Cæs", CaseSensitivity(true), CustomNormaliser(LowerCase)))
+	})
+
+	t.Run("Domain rules", func(t *testing.T) {
+		brand := Chain(
+			NormaliserFunc(func(word string) (string, error) {
+				return strings.TrimPrefix(strings.ReplaceAll(strings.ToLower(word), "®", ""), "the "), nil
+			}),
+			StripAccents,
+		)
+		tr, err := NewWithOptions(append(exact, CustomNormaliser(brand))...)
+		assert.NoError(t, err)
+		tr.Insert("The Beatles", "Lego®")
+		assert.Equal(t, []string{"The Beatles"}, tr.SearchAll("beat"))
+		assert.Equal(t, []string{"Lego®"}, tr.SearchAll("the lego"))
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		errRejected := errors.New("rejected")
+		strict := NormaliserFunc(func(word string) (string, error) {
+			if strings.ContainsAny(word, "0123456789") {
+				return "", errRejected
+			}
+			return word, nil
+		})
+		tr, err := NewWithOptions(CustomNormaliser(strict))
+		assert.NoError(t, err)
+		err = tr.TryInsert("hello", "h3llo")
+		assert.True(t, errors.Is(err, errRejected))
+		assert.Equal(t, []string{"hello"}, tr.SearchAll("hel"))
+		matches, err := tr.SearchContext(context.Background(), "h3l", 0)
+		assert.Empty(t, matches)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Reconfigure", func(t *testing.T) {
+		tr := New()
+		tr.Insert("Cæsar", "Caesar")
+		assert.Equal(t, []string{"Cæsar"}, tr.SearchAll("cæs", exact...))
+		assert.NoError(t, tr.Reconfigure(CustomNormaliser(ligatureFolding)))
+		assert.Equal(t, []string{"Caesar", "Cæsar"}, tr.SearchAll("cæs", exact...))
+	})
+
+	t.Run("Snapshots and compact indexes", func(t *testing.T) {
+		tr, err := NewWithOptions(CustomNormaliser(ligatureFolding))
+		assert.NoError(t, err)
+		tr.Insert("Cæsar")
+		data, err := tr.MarshalBinary()
+		assert.NoError(t, err)
+
+		assert.True(t, errors.Is(New().UnmarshalBinary(data), ErrMissingNormaliser))
+		loaded, err := NewWithOptions(CustomNormaliser(ligatureFolding))
+		assert.NoError(t, err)
+		assert.NoError(t, loaded.UnmarshalBinary(data))
+		assert.Equal(t, []string{"Cæsar"}, loaded.SearchAll("caes"))
+
+		// a snapshot without a custom normaliser removes the reader's
+		plain, err := New().MarshalBinary()
+		assert.NoError(t, err)
+		assert.NoError(t, loaded.UnmarshalBinary(plain))
+		assert.Nil(t, loaded.normaliser)
+
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Cæsar"}, c.SearchAll("caes"))
+		var buf strings.Builder
+		_, err = tr.WriteCompact(&buf)
+		assert.NoError(t, err)
+		_, err = LoadCompact([]byte(buf.String()), nil)
+		assert.True(t, errors.Is(err, ErrMissingNormaliser))
+		c, err = LoadCompact([]byte(buf.String()), nil, CustomNormaliser(ligatureFolding))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Cæsar"}, c.SearchAll("caes"))
+	})
+}
+
+func TestCaseFolding(t *testing.T) {
+	exact := []Option{Fuzzy(false), Levenshtein(map[uint8]uint8{0: 0})}
+
+	t.Run("Full folding", func(t *testing.T) {
+		tr, err := NewWithOptions(exact...)
+		assert.NoError(t, err)
+		tr.Insert("Straße", "ΣΟΦΟΣ")
+		assert.Equal(t, []string{"Straße"}, tr.SearchAll("STRASS"))
+		assert.Equal(t, []string{"Straße"}, tr.SearchAll("straß"))
+		assert.Equal(t, []string{"ΣΟΦΟΣ"}, tr.SearchAll("σοφος"))
+		assert.Equal(t, []string{"ΣΟΦΟΣ"}, tr.SearchAll("σοφοσ"))
+	})
+
+	t.Run("Turkish", func(t *testing.T) {
+		tr, err := NewWithOptions(append(exact, Language(language.Turkish))...)
+		assert.NoError(t, err)
+		tr.Insert("İstanbul", "Isparta")
+		assert.Equal(t, []string{"İstanbul"}, tr.SearchAll("istan"))
+		assert.Equal(t, []string{"İstanbul"}, tr.SearchAll("İSTAN"))
+		assert.Empty(t, tr.SearchAll("ıstan"))
+		assert.Equal(t, []string{"Isparta"}, tr.SearchAll("ısp"))
+		assert.Empty(t, tr.SearchAll("isp"))
+
+		// a query cannot change the language of the index
+		assert.Empty(t, tr.SearchAll("isp", Language(language.Und)))
+	})
+
+	t.Run("Reconfigure language", func(t *testing.T) {
+		tr, err := NewWithOptions(exact...)
+		assert.NoError(t, err)
+		tr.Insert("Isparta")
+		assert.Equal(t, []string{"Isparta"}, tr.SearchAll("isp"))
+		assert.NoError(t, tr.Reconfigure(Language(language.Turkish)))
+		assert.Equal(t, []string{"Isparta"}, tr.SearchAll("ısp"))
+	})
+
+	t.Run("Snapshots and compact indexes keep the language", func(t *testing.T) {
+		tr, err := NewWithOptions(append(exact, Language(language.Turkish))...)
+		assert.NoError(t, err)
+		tr.Insert("Isparta")
+		data, err := tr.MarshalBinary()
+		assert.NoError(t, err)
+		loaded := New()
+		assert.NoError(t, loaded.UnmarshalBinary(data))
+		assert.Equal(t, language.Turkish, loaded.language)
+		assert.Equal(t, []string{"Isparta"}, loaded.SearchAll("ISP"))
+		assert.Empty(t, loaded.SearchAll("isp"))
+
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		assert.Equal(t, language.Turkish, c.language)
+		assert.Empty(t, c.SearchAll("isp"))
+	})
+
+	t.Run("Snapshots from before case folding", func(t *testing.T) {
+		// "Aß" with the default settings in a version 1 snapshot, keyed as "aß"
+		data := []byte("GATRIE\x01\x03\x03\x00\x00\x03\x01\x05\x02\x00\x01a\x00\x01\xdf\x01" +
+			"\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x03A\xc3\x9f\x00")
+		loaded := New()
+		assert.NoError(t, loaded.UnmarshalBinary(data))
+		assert.Equal(t, []string{"Aß"}, loaded.SearchAll("ASS"))
+		_, ok := loaded.FindMeta("ass")
+		assert.True(t, ok)
+	})
+}
+
+func TestCompatibility(t *testing.T) {
+	exact := []Option{Fuzzy(false), Levenshtein(map[uint8]uint8{0: 0})}
+
+	t.Run("Folding", func(t *testing.T) {
+		for word, plain := range map[string]string{"ｉＰｈｏｎｅ": "iPhone", "ﬁle": "file", "x²": "x2", "①": "1", "ｶﾀｶﾅ": "カタカナ"} {
+			folded, err := FoldCompatibility.Normalise(word)
+			assert.NoError(t, err)
+			assert.Equal(t, plain, folded)
+		}
+	})
+
+	t.Run("Off by default", func(t *testing.T) {
+		tr, err := NewWithOptions(exact...)
+		assert.NoError(t, err)
+		tr.Insert("iPhone")
+		assert.Empty(t, tr.SearchAll("ｉｐｈ"))
+	})
+
+	t.Run("Insert and search", func(t *testing.T) {
+		tr, err := NewWithOptions(append(exact, Compatibility(true))...)
+		assert.NoError(t, err)
+		tr.InsertWithMeta("iPhone", 1)
+		tr.InsertWithMeta("ｉＰａｄ", 2)
+		tr.Insert("ﬁnance", "カタカナ")
+		assert.Equal(t, []Match{{Word: "ｉＰａｄ", Meta: 2}, {Word: "iPhone", Meta: 1}}, tr.SearchAllMeta("ｉｐ"))
+		assert.Equal(t, []string{"ﬁnance"}, tr.SearchAll("fin"))
+		assert.Equal(t, []string{"カタカナ"}, tr.SearchAll("ｶﾀ"))
+		meta, ok := tr.FindMeta("ipad")
+		assert.True(t, ok)
+		assert.Equal(t, 2, meta)
+		assert.True(t, tr.Delete("ｉＰａｄ"))
+		assert.Equal(t, []string{"iPhone"}, tr.SearchAll("ｉｐ"))
+	})
+
+	t.Run("Case sensitive", func(t *testing.T) {
+		tr, err := NewWithOptions(append(exact, Compatibility(true), CaseSensitivity(true), Normalisation(false))...)
+		assert.NoError(t, err)
+		tr.Insert("ｉＰｈｏｎｅ")
+		assert.Equal(t, []string{"ｉＰｈｏｎｅ"}, tr.SearchAll("iP"))
+		assert.Empty(t, tr.SearchAll("ip"))
+	})
+
+	t.Run("Reconfigure, snapshots and compact indexes", func(t *testing.T) {
+		tr, err := NewWithOptions(exact...)
+		assert.NoError(t, err)
+		tr.Insert("ｉＰｈｏｎｅ")
+		assert.NoError(t, tr.Reconfigure(Compatibility(true)))
+		assert.Equal(t, []string{"ｉＰｈｏｎｅ"}, tr.SearchAll("iph"))
+
+		data, err := tr.MarshalBinary()
+		assert.NoError(t, err)
+		loaded := New()
+		assert.NoError(t, loaded.UnmarshalBinary(data))
+		assert.True(t, loaded.compatible)
+		assert.Equal(t, []string{"ｉＰｈｏｎｅ"}, loaded.SearchAll("iph"))
+
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"ｉＰｈｏｎｅ"}, c.SearchAll("iph"))
+	})
+}
+
+func TestPunctuation(t *testing.T) {
+	exact := []Option{Fuzzy(false), Levenshtein(map[uint8]uint8{0: 0})}
+
+	t.Run("Folding", func(t *testing.T) {
+		for word, keys := range map[string][2]string{
+			"e-mail":       {"e mail", "email"},
+			"  T--Shirt! ": {"T Shirt ", "TShirt"},
+			"Wi-Fi":        {"Wi Fi", "WiFi"},
+			"a.b, c":       {"a b c", "abc"},
+		} {
+			collapsed, err := CollapsePunctuation.Normalise(word)
+			assert.NoError(t, err)
+			assert.Equal(t, keys[0], collapsed)
+			stripped, err := StripPunctuation.Normalise(word)
+			assert.NoError(t, err)
+			assert.Equal(t, keys[1], stripped)
+		}
+	})
+
+	t.Run("Kept by default", func(t *testing.T) {
+		tr, err := NewWithOptions(exact...)
+		assert.NoError(t, err)
+		tr.Insert("e-mail")
+		assert.Empty(t, tr.SearchAll("email"))
+		assert.Empty(t, tr.SearchAll("e mail"))
+	})
+
+	t.Run("Stripped", func(t *testing.T) {
+		tr, err := NewWithOptions(append(exact, Punctuation(PunctuationStripped))...)
+		assert.NoError(t, err)
+		tr.InsertWithMeta("e-mail", 1)
+		tr.InsertWithMeta("email", 2)
+		tr.Insert("T-Shirt", "Wi-Fi")
+		assert.Equal(t, []Match{{Word: "e-mail", Meta: 1, Exact: true}, {Word: "email", Meta: 2, Exact: true}}, tr.SearchAllMeta("e mail"))
+		assert.Equal(t, []string{"T-Shirt"}, tr.SearchAll("tshirt"))
+		assert.Equal(t, []string{"T-Shirt"}, tr.SearchAll("t shirt"))
+		assert.Equal(t, []string{"Wi-Fi"}, tr.SearchAll("wifi"))
+		meta, ok := tr.FindMeta("e-mail")
+		assert.True(t, ok)
+		assert.Equal(t, 1, meta)
+		meta, ok = tr.FindMeta("e.mail")
+		assert.True(t, ok)
+		assert.Equal(t, 2, meta)
+		// a query without letters or digits finds nothing rather than everything
+		assert.Empty(t, tr.SearchAll("-"))
+		assert.Error(t, tr.TryInsert("--"))
+	})
+
+	t.Run("Collapsed", func(t *testing.T) {
+		tr, err := NewWithOptions(append(exact, Punctuation(PunctuationCollapsed))...)
+		assert.NoError(t, err)
+		tr.Insert("e-mail", "T-Shirt", "Tea")
+		assert.Equal(t, []string{"e-mail"}, tr.SearchAll("e mail"))
+		assert.Empty(t, tr.SearchAll("email"))
+		assert.Equal(t, []string{"T-Shirt"}, tr.SearchAll("t-"))
+		assert.Equal(t, []string{"T-Shirt"}, tr.SearchAll("t  shi"))
+	})
+
+	t.Run("Invalid mode", func(t *testing.T) {
+		_, err := NewWithOptions(Punctuation(PunctuationStripped + 1))
+		assert.Error(t, err)
+
+		// an empty snapshot with both punctuation modes
+		tr := New()
+		err = tr.UnmarshalBinary([]byte("GATRIE\x02\x63\x03\x00\x00\x03\x01\x05\x02\x00\x00\x00\x00"))
+		assert.True(t, errors.Is(err, ErrInvalidSnapshot))
+		assert.Equal(t, PunctuationKept, tr.punctuation)
+	})
+
+	t.Run("Reconfigure, snapshots and compact indexes", func(t *testing.T) {
+		tr, err := NewWithOptions(exact...)
+		assert.NoError(t, err)
+		tr.Insert("Wi-Fi")
+		assert.NoError(t, tr.Reconfigure(Punctuation(PunctuationStripped)))
+		assert.Equal(t, []string{"Wi-Fi"}, tr.SearchAll("wif"))
+		// a query cannot change the punctuation mode of the index
+		assert.Equal(t, []string{"Wi-Fi"}, tr.SearchAll("wif", Punctuation(PunctuationKept)))
+
+		data, err := tr.MarshalBinary()
+		assert.NoError(t, err)
+		loaded := New()
+		assert.NoError(t, loaded.UnmarshalBinary(data))
+		assert.Equal(t, PunctuationStripped, loaded.punctuation)
+		assert.Equal(t, []string{"Wi-Fi"}, loaded.SearchAll("wif"))
+
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Wi-Fi"}, c.SearchAll("wif"))
+	})
+}
@@ -0,0 +1,191 @@
+package trie
+
+import (
+	"errors"
+	"maps"
+	"slices"
+)
+
+// ErrInvalidLevenshtein is returned for a levenshtein scheme without an entry for search
+// strings of length zero.
+var ErrInvalidLevenshtein = errors.New("trie: invalid levenshtein scheme")
+
+// Option configures a new Trie in NewWithOptions, or overrides a setting of a Trie or Compact
+// for a single search without changing the settings other searches use.
+//
+// Fuzzy matching and the levenshtein scheme can be changed freely. Normalisation and case
+// sensitivity decide how words are indexed, so a query can only be stricter than the index:
+// a case sensitive query on a case insensitive trie matches the case of the original words,
+// but a case insensitive query on a case sensitive trie stays case sensitive.
+type Option func(*settings) error
+
+// Fuzzy turns fuzzy matching on or off.
+func Fuzzy(enabled bool) Option {
+	return func(s *settings) error {
+		s.fuzzy = enabled
+		return nil
+	}
+}
+
+// Normalisation turns normalisation on or off.
+func Normalisation(enabled bool) Option {
+	return func(s *settings) error {
+		s.normalised = enabled
+		return nil
+	}
+}
+
+// CaseSensitivity turns case sensitive matching on or off.
+func CaseSensitivity(sensitive bool) Option {
+	return func(s *settings) error {
+		s.caseSensitive = sensitive
+		return nil
+	}
+}
+
+// Filter leaves out of a search the words whose metadata keep does not keep. It is called
+// while the trie is searched, before a word is ranked, so a limited search still returns up to
+// limit words that keep keeps. Nil metadata is passed as the zero value of T, and words with
+// other metadata that is not a T are left out. A filter for a whole trie, set with
+// NewWithOptions, is not stored in snapshots or compact indexes, and a nil keep removes it.
+func Filter[T any](keep func(meta T) bool) Option {
+	return func(s *settings) error {
+		if keep == nil {
+			s.filter = nil
+			return nil
+		}
+		s.filter = func(meta interface{}) bool {
+			v, ok := meta.(T)
+			if !ok && meta != nil {
+				return false
+			}
+			return keep(v)
+		}
+		return nil
+	}
+}
+
+// Levenshtein sets the levenshtein scheme, a series of pairs of search string length ->
+// levenshtein distance with one entry for length zero. A scheme of {0: 0} allows no
+// levenshtein distance at all.
+func Levenshtein(scheme map[uint8]uint8) Option {
+	return func(s *settings) error {
+		if _, ok := scheme[0]; !ok {
+			return ErrInvalidLevenshtein
+		}
+		s.setLevenshtein(scheme)
+		return nil
+	}
+}
+
+// NewWithOptions creates a new empty trie with the settings of New changed by opts. It checks
+// every option before the trie is used, and returns the errors of all invalid options joined.
+func NewWithOptions(opts ...Option) (*Trie, error) {
+	t := New()
+	var errs []error
+	for _, opt := range opts {
+		errs = append(errs, opt(&t.settings))
+	}
+	errs = append(errs, t.settings.checkTerms())
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reconfigure changes the settings of the trie with opts and reindexes every word under the
+// new settings, with its metadata, weight and selections. The trie is rebuilt under the write
+// lock and swapped in at once, so searches see it either before or after the change. If an
+// option is invalid or a word cannot be indexed under the new settings, the trie is left
+// unchanged and the errors are returned joined.
+//
+// Words are reindexed as they were inserted, except on a trie that is case sensitive and not
+// normalised, which only keeps the indexed form. Words that end up with the same key keep
+// the highest of their weights and of their selections.
+func (t *Trie) Reconfigure(opts ...Option) error {
+	t.lock()
+	defer t.mu.Unlock()
+	rebuilt := New()
+	rebuilt.settings = t.settings
+	rebuilt.gen = t.gen
+	rebuilt.root.gen = t.gen
+	var errs []error
+	for _, opt := range opts {
+		errs = append(errs, opt(&rebuilt.settings))
+	}
+	errs = append(errs, rebuilt.settings.checkTerms())
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	if err := errors.Join(rebuilt.reindex(t.root)...); err != nil {
+		return err
+	}
+	t.root, t.starts = rebuilt.root, rebuilt.starts
+	t.settings = rebuilt.settings
+	return nil
+}
+
+// reindex inserts every word in the tree under n into t, with its metadata, weight and
+// selections, and returns an error for each word it could not insert. Words that end up with
+// the same key keep the highest of their weights and of their selections.
+func (t *Trie) reindex(n *node) []error {
+	var errs []error
+	if n.word != "" {
+		variants := n.variants
+		if len(variants) == 0 {
+			variants = []entry{{n.word, n.meta}}
+		}
+		for _, v := range variants {
+			weight := n.weight
+			if key, err := t.key(v.word); err == nil {
+				if existing, ok := findIndex[*node](trieIndex{t}, key); ok {
+					weight = max(weight, existing.weight)
+				}
+			}
+			if err := t.insertInternal(v.word, v.meta, weight); err != nil {
+				errs = append(errs, err)
+			} else if n.selections != 0 {
+				t.keepSelections(v.word, n.selections, n.selectedAt)
+			}
+		}
+	}
+	for _, r := range slices.Sorted(maps.Keys(n.children)) {
+		errs = append(errs, t.reindex(n.children[r])...)
+	}
+	return errs
+}
+
+// withOptions returns a copy of s with opts applied. Normalisation and case sensitivity are
+// kept as strict as in s, as the index cannot find words it did not keep apart, and the
+// normaliser, language, compatibility normalisation, punctuation mode and selection half-life
+// are kept as they are. Word starts can only be turned off.
+func (s *settings) withOptions(opts []Option) (*settings, error) {
+	if len(opts) == 0 {
+		return s, nil
+	}
+	q := *s
+	for _, opt := range opts {
+		if err := opt(&q); err != nil {
+			return nil, err
+		}
+	}
+	q.normalised = q.normalised && s.normalised
+	q.caseSensitive = q.caseSensitive || s.caseSensitive
+	// a custom normaliser, the language, compatibility and punctuation decide the keys for the
+	// whole index
+	q.normaliser, q.language, q.compatible, q.punctuation = s.normaliser, s.language, s.compatible, s.punctuation
+	// the selections of a word are decayed with the half-life of the index as they are recorded
+	q.halfLife = s.halfLife
+	// only an index with word starts can match them
+	q.wordStarts = q.wordStarts && s.wordStarts
+	if s.normaliser != nil {
+		q.normalised, q.caseSensitive = s.normalised, s.caseSensitive
+	}
+	return &q, nil
+}
+
+// stricterThan reports whether s keeps apart words that share a key under the settings of
+// the index.
+func (s *settings) stricterThan(index *settings) bool {
+	return s.normalised != index.normalised || s.caseSensitive != index.caseSensitive
+}
@@ -0,0 +1,192 @@
+package trie
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions(t *testing.T) {
+	exact := []Option{Fuzzy(false), Levenshtein(map[uint8]uint8{0: 0})}
+
+	t.Run("Strict and lenient queries", func(t *testing.T) {
+		tr := New()
+		tr.Insert("hello", "help", "world")
+		assert.Equal(t, []string{"help", "hello"}, tr.SearchAll("helo"))
+		assert.Empty(t, tr.SearchAll("helo", exact...))
+		assert.Equal(t, []string{"help", "hello"}, tr.SearchAll("hel", exact...))
+		assert.Equal(t, []string{"hello"}, tr.Search("ello", 1, Levenshtein(map[uint8]uint8{0: 0})))
+		assert.Empty(t, tr.Search("ello", 1, exact...))
+		// the trie keeps its own settings
+		assert.True(t, tr.fuzzy)
+		assert.Equal(t, []string{"help", "hello"}, tr.SearchAll("helo"))
+	})
+
+	t.Run("Stricter case sensitivity", func(t *testing.T) {
+		tr := New()
+		tr.Insert("Hello", "hello")
+		tr.InsertWeighted("Help", 1, 2)
+		assert.Equal(t, []string{"Help", "hello", "Hello"}, tr.SearchAll("hel", exact...))
+		matches := tr.SearchAllMeta("Hel", append(exact, CaseSensitivity(true))...)
+		assert.Equal(t, []Match{{Word: "Help", Meta: 1}, {Word: "Hello"}}, matches)
+		assert.Equal(t, []string{"hello"}, tr.Search("hel", 1, CaseSensitivity(true)))
+	})
+
+	t.Run("Stricter normalisation", func(t *testing.T) {
+		tr := New()
+		tr.Insert("Jürgen", "Jurgen")
+		assert.Equal(t, []string{"Jürgen", "Jurgen"}, tr.SearchAll("jür", exact...))
+		assert.Equal(t, []string{"Jürgen"}, tr.SearchAll("jür", append(exact, Normalisation(false))...))
+		assert.Equal(t, []string{"Jurgen"}, tr.SearchAll("jur", append(exact, Normalisation(false))...))
+	})
+
+	t.Run("Stricter searches match like a stricter trie", func(t *testing.T) {
+		rnd := rand.New(rand.NewSource(7))
+		letters := []rune("abAéE ")
+		tr, err := NewWithOptions(WordStarts(true))
+		assert.NoError(t, err)
+		strict, err := NewWithOptions(WordStarts(true), CaseSensitivity(true), Normalisation(false))
+		assert.NoError(t, err)
+		for i := 0; i < 500; i++ {
+			word := make([]rune, 1+rnd.Intn(6))
+			for j := range word {
+				word[j] = letters[rnd.Intn(len(letters))]
+			}
+			tr.Insert(string(word))
+			strict.Insert(string(word))
+		}
+		for _, query := range []string{"a", "Ab", "éa", "E b"} {
+			opts := []Option{CaseSensitivity(true), Normalisation(false)}
+			all := tr.SearchAllMeta(query, opts...)
+			assert.ElementsMatch(t, strict.SearchAllMeta(query), all)
+			for _, limit := range []int{1, 3, 10} {
+				assert.Equal(t, all[:min(limit, len(all))], tr.SearchMeta(query, limit, opts...))
+			}
+		}
+	})
+
+	t.Run("Looser settings have no effect", func(t *testing.T) {
+		tr := New().CaseSensitive().WithoutNormalisation()
+		tr.Insert("Hello", "Jürgen")
+		assert.Empty(t, tr.SearchAll("hel", append(exact, CaseSensitivity(false))...))
+		assert.Empty(t, tr.SearchAll("Jur", append(exact, Normalisation(true))...))
+	})
+
+	t.Run("Invalid option", func(t *testing.T) {
+		tr := New()
+		tr.Insert("hello")
+		assert.Empty(t, tr.SearchAll("hel", Levenshtein(map[uint8]uint8{3: 1})))
+		matches, err := tr.SearchContext(context.Background(), "hel", 0, Levenshtein(nil))
+		assert.Empty(t, matches)
+		assert.True(t, errors.Is(err, ErrInvalidLevenshtein))
+	})
+
+	t.Run("Compact", func(t *testing.T) {
+		tr := New()
+		tr.Insert("Hello", "hello", "help", "Jürgen")
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		for _, opts := range [][]Option{
+			nil,
+			exact,
+			{CaseSensitivity(true)},
+			{Normalisation(false), Fuzzy(false)},
+		} {
+			for _, query := range []string{"hel", "Hel", "helo", "jür", "jur"} {
+				assert.Equal(t, tr.SearchAllMeta(query, opts...), c.SearchAllMeta(query, opts...))
+			}
+		}
+	})
+
+	t.Run("Generic", func(t *testing.T) {
+		g := NewG[Product]()
+		g.Insert("iPhone", Product{ID: 1, Price: 999})
+		g.Insert("iphone case", Product{ID: 2, Price: 19})
+		hits := g.SearchAll("iP", CaseSensitivity(true))
+		assert.Equal(t, 1, len(hits))
+		assert.Equal(t, Product{ID: 1, Price: 999}, hits[0].Meta)
+	})
+}
+
+func TestNewWithOptions(t *testing.T) {
+	t.Run("Settings", func(t *testing.T) {
+		tr, err := NewWithOptions(Fuzzy(false), CaseSensitivity(true), Levenshtein(map[uint8]uint8{0: 0}))
+		assert.NoError(t, err)
+		tr.Insert("Hello", "hello")
+		assert.Equal(t, []string{"Hello"}, tr.SearchAll("Hel"))
+		assert.Empty(t, tr.SearchAll("ello"))
+	})
+
+	t.Run("Defaults", func(t *testing.T) {
+		tr, err := NewWithOptions()
+		assert.NoError(t, err)
+		assert.Equal(t, New().settings, tr.settings)
+	})
+
+	t.Run("Invalid options", func(t *testing.T) {
+		tr, err := NewWithOptions(Levenshtein(map[uint8]uint8{3: 1}), Fuzzy(false), Levenshtein(nil))
+		assert.Nil(t, tr)
+		assert.True(t, errors.Is(err, ErrInvalidLevenshtein))
+		assert.Equal(t, 2, len(err.(interface{ Unwrap() []error }).Unwrap()))
+	})
+}
+
+func TestReconfigure(t *testing.T) {
+	t.Run("Stricter settings", func(t *testing.T) {
+		tr := New()
+		tr.InsertWithMeta("Jürgen", 1)
+		tr.InsertWeighted("jurgen", 2, 5)
+		assert.NoError(t, tr.Reconfigure(Normalisation(false), CaseSensitivity(true), Levenshtein(map[uint8]uint8{0: 0})))
+		assert.Equal(t, []Match{{Word: "Jürgen", Meta: 1}}, tr.SearchAllMeta("Jür"))
+		assert.Equal(t, []Match{{Word: "jurgen", Meta: 2}}, tr.SearchAllMeta("jur"))
+		assert.Empty(t, tr.SearchAll("JUR"))
+		meta, ok := tr.FindMeta("jurgen")
+		assert.True(t, ok)
+		assert.Equal(t, 2, meta)
+	})
+
+	t.Run("Looser settings", func(t *testing.T) {
+		tr := New().CaseSensitive().WithoutNormalisation()
+		tr.InsertWeighted("Jürgen", 1, 1)
+		tr.InsertWeighted("jurgen", 2, 3)
+		assert.NoError(t, tr.Reconfigure(Normalisation(true), CaseSensitivity(false)))
+		assert.Equal(t, []Match{{Word: "Jürgen", Meta: 1}, {Word: "jurgen", Meta: 2}}, tr.SearchAllMeta("JUR"))
+		n, ok := findIndex[*node](trieIndex{tr}, "jurgen")
+		assert.True(t, ok)
+		assert.Equal(t, 3.0, n.weight)
+	})
+
+	t.Run("Settings changed after inserting", func(t *testing.T) {
+		tr := New()
+		tr.Insert("Hello")
+		tr.CaseSensitive().WithoutLevenshtein()
+		assert.Empty(t, tr.SearchAll("Hel"))
+		assert.NoError(t, tr.Reconfigure())
+		assert.Equal(t, []string{"Hello"}, tr.SearchAll("Hel"))
+	})
+
+	t.Run("Errors leave the trie unchanged", func(t *testing.T) {
+		tr := New()
+		tr.Insert("hello")
+		err := tr.Reconfigure(Fuzzy(false), Levenshtein(nil))
+		assert.True(t, errors.Is(err, ErrInvalidLevenshtein))
+		assert.True(t, tr.fuzzy)
+		assert.Equal(t, []string{"hello"}, tr.SearchAll("hel"))
+	})
+
+	t.Run("Persistent", func(t *testing.T) {
+		p := NewPersistent()
+		p.Insert("Hello", "hello")
+		before := p.Snapshot()
+		var err error
+		p.Update(func(tr *Trie) {
+			err = tr.Reconfigure(CaseSensitivity(true), Levenshtein(map[uint8]uint8{0: 0}))
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Hello"}, p.SearchAll("Hel"))
+		assert.Equal(t, []string{"Hello", "hello"}, before.SearchAll("Hel"))
+	})
+}
@@ -0,0 +1,92 @@
+package trie
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Persistent is a trie for workloads that search while they write a lot. Its readers never
+// lock: every search runs on the current snapshot, an immutable Trie published through an
+// atomic pointer. Writers change a draft of the next snapshot in Update, which shares all the
+// nodes it does not touch with the current one and copies only the paths to the nodes it
+// changes, then publish it in one step.
+//
+// A Persistent is safe for concurrent use by multiple goroutines. Updates are serialised, and
+// searches see every update either completely or not at all.
+type Persistent struct {
+	current atomic.Pointer[Trie]
+	// mu serialises writers.
+	mu sync.Mutex
+}
+
+// NewPersistent creates a Persistent whose first snapshot is an empty trie with the default
+// settings of New.
+func NewPersistent() *Persistent {
+	p := new(Persistent)
+	t := New()
+	t.published = true
+	p.current.Store(t)
+	return p
+}
+
+// Snapshot returns the current snapshot. It stays unchanged by later updates and can be read
+// without locking, but it panics when it is changed.
+func (p *Persistent) Snapshot() *Trie {
+	return p.current.Load()
+}
+
+// Update calls update with a draft of the next snapshot, which starts out like the current
+// one, and publishes it when update returns. The draft may be changed with any method of Trie,
+// so a batch of inserts, deletes and configuration changes becomes visible at once. If update
+// panics, nothing is published.
+func (p *Persistent) Update(update func(t *Trie)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	current := p.current.Load()
+	draft := &Trie{
+		root:      current.root,
+		starts:    current.starts,
+		settings:  current.settings,
+		gen:       current.gen + 1,
+		metaCodec: current.metaCodec,
+	}
+	update(draft)
+	draft.published = true
+	p.current.Store(draft)
+}
+
+// Insert inserts strings in a single update.
+func (p *Persistent) Insert(entries ...string) {
+	p.Update(func(t *Trie) { t.Insert(entries...) })
+}
+
+// FindMeta returns the metadata stored for the exact word in the current snapshot, if present.
+func (p *Persistent) FindMeta(word string) (interface{}, bool) {
+	return p.Snapshot().FindMeta(word)
+}
+
+// SearchAll is just like Search, but without a limit.
+func (p *Persistent) SearchAll(search string, opts ...Option) []string {
+	return p.Snapshot().SearchAll(search, opts...)
+}
+
+// SearchAllMeta performs a fuzzy search of the current snapshot returning words with their metadata.
+func (p *Persistent) SearchAllMeta(search string, opts ...Option) []Match {
+	return p.Snapshot().SearchAllMeta(search, opts...)
+}
+
+// Search searches the current snapshot exactly like Trie.Search.
+func (p *Persistent) Search(search string, limit int, opts ...Option) []string {
+	return p.Snapshot().Search(search, limit, opts...)
+}
+
+// SearchMeta is just like Search, but returns the words with their metadata.
+func (p *Persistent) SearchMeta(search string, limit int, opts ...Option) []Match {
+	return p.Snapshot().SearchMeta(search, limit, opts...)
+}
+
+// SearchContext searches the current snapshot exactly like Trie.SearchContext.
+func (p *Persistent) SearchContext(ctx context.Context, search string, limit int, opts ...Option) ([]Match, error) {
+	return p.Snapshot().SearchContext(ctx, search, limit, opts...)
+}
@@ -0,0 +1,102 @@
+package trie
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersistent(t *testing.T) {
+	t.Run("Snapshots", func(t *testing.T) {
+		p := NewPersistent()
+		p.Insert("hello", "Help")
+		before := p.Snapshot()
+		p.Update(func(t *Trie) {
+			t.Delete("Help")
+			t.InsertWithMeta("helium", 2)
+		})
+		assert.Equal(t, []string{"hello", "Help"}, before.SearchAll("hel"))
+		assert.Equal(t, []string{"hello", "helium"}, p.SearchAll("hel"))
+		meta, ok := p.FindMeta("helium")
+		assert.True(t, ok)
+		assert.Equal(t, 2, meta)
+		_, ok = before.FindMeta("helium")
+		assert.False(t, ok)
+	})
+
+	t.Run("Untouched nodes are shared", func(t *testing.T) {
+		p := NewPersistent()
+		p.Insert("hello", "world")
+		before := p.Snapshot()
+		p.Insert("help")
+		after := p.Snapshot()
+		assert.Same(t, before.root.children['w'], after.root.children['w'])
+		assert.NotSame(t, before.root.children['h'], after.root.children['h'])
+	})
+
+	t.Run("Settings", func(t *testing.T) {
+		p := NewPersistent()
+		p.Update(func(t *Trie) {
+			t.WithoutFuzzy().WithoutLevenshtein().CaseSensitive()
+			t.Insert("Hello")
+		})
+		assert.Empty(t, p.SearchAll("hel"))
+		assert.Equal(t, []string{"Hello"}, p.SearchAll("Hel"))
+	})
+
+	t.Run("Failed update", func(t *testing.T) {
+		p := NewPersistent()
+		p.Insert("hello")
+		assert.Panics(t, func() {
+			p.Update(func(t *Trie) {
+				t.Insert("help")
+				panic("abort")
+			})
+		})
+		assert.Equal(t, []string{"hello"}, p.SearchAll("hel"))
+	})
+
+	t.Run("Snapshots are read-only", func(t *testing.T) {
+		p := NewPersistent()
+		assert.Panics(t, func() { p.Snapshot().Insert("hello") })
+		assert.Panics(t, func() { p.Snapshot().WithoutFuzzy() })
+	})
+
+	t.Run("Concurrent updates and searches", func(t *testing.T) {
+		p := NewPersistent()
+		p.Insert("hello", "help")
+		var wg sync.WaitGroup
+		wg.Add(4)
+		for g := 0; g < 2; g++ {
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					p.Update(func(t *Trie) {
+						t.InsertWeighted(fmt.Sprintf("hel%d-%d", g, i), i, float64(i))
+						t.Delete(fmt.Sprintf("hel%d-%d", g, i-1))
+					})
+				}
+			}(g)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					// every update leaves one word of each writer, once both have started
+					assert.LessOrEqual(t, len(p.SearchAll("hel")), 4)
+					assert.Subset(t, p.SearchAll("hel"), []string{"hello", "help"})
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, []string{"hel0-99", "hel1-99", "help", "hello"}, p.SearchAll("hel"))
+	})
+}
+
+func BenchmarkPersistentInsert(b *testing.B) {
+	p := NewPersistent()
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		p.Insert(fmt.Sprintf("word%d", n%1000))
+	}
+}
@@ -0,0 +1,120 @@
+package trie
+
+import (
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Candidate is a word found by a search, as it is ranked by a Ranker. See Match for the meaning
+// of the fields it shares with it.
+type Candidate struct {
+	Word     string
+	Meta     interface{}
+	Distance int
+	Fuzzy    bool
+	Exact    bool
+	MidEntry bool
+	// Weight is the ranking weight the word was inserted with.
+	Weight float64
+	// Selections is the number of times the word was selected with RecordSelection, decayed to
+	// the time of the search.
+	Selections float64
+	// Typed reports whether Word starts with the search string exactly as it was typed, in case
+	// and accents, or with AllTerms, whether it holds every term of it as typed.
+	Typed bool
+	// Length is the number of characters of Word as it is indexed.
+	Length int
+}
+
+// Ranker orders the results of a search. Rank returns the score of a candidate, and the
+// results are ordered by their scores, compared element by element with the lowest first, and
+// then alphabetically. A shorter score that is a prefix of a longer one ranks first.
+type Ranker interface {
+	Rank(c Candidate) []float64
+}
+
+// RankerFunc adapts a function to a Ranker.
+type RankerFunc func(c Candidate) []float64
+
+// Rank calls f(c).
+func (f RankerFunc) Rank(c Candidate) []float64 { return f(c) }
+
+// DefaultRanker orders candidates like a search without a Ranker: words matched at their start
+// before words matched at a later word, then by levenshtein distance, then matches without
+// skipped characters before fuzzy ones, then whole-word matches before completions, then by
+// descending weight, then by descending selections, then words typed like the search string
+// before the others, then shorter words before longer ones. Words with the same score are
+// ordered by their original form rather than by their key, and a search with a Ranker cannot
+// skip the branches of the trie that cannot reach its limit, so it is only worth wrapping in a
+// Ranker of its own.
+var DefaultRanker Ranker = RankerFunc(func(c Candidate) []float64 {
+	return []float64{
+		flag(c.MidEntry), float64(c.Distance), flag(c.Fuzzy), flag(!c.Exact), -c.Weight, -c.Selections, flag(!c.Typed), float64(c.Length),
+	}
+})
+
+// flag returns 1 for true and 0 for false.
+func flag(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Ranking orders the results of searches with r instead of the default order. A search with a
+// Ranker finds every match before it can tell the best ones, so its limit does not make it any
+// faster. A nil Ranker restores the default order. A Ranker for a whole trie, set with
+// NewWithOptions, is not stored in snapshots or compact indexes.
+func Ranking(r Ranker) Option {
+	return func(s *settings) error {
+		s.ranker = r
+		return nil
+	}
+}
+
+// rankMatches orders matches of search from idx, indexed with the settings s, with the ranker
+// of the query settings q. The words are looked up with the keys of the index, whatever q.
+func rankMatches[N any](idx index[N], s, q *settings, search string, matches []Match) []Match {
+	type ranked struct {
+		match Match
+		score []float64
+	}
+	candidates := make([]ranked, len(matches))
+	now := time.Now().UnixNano()
+	for i, m := range matches {
+		var weight, selections float64
+		var length int
+		if key, err := s.key(m.Word); err == nil {
+			length = utf8.RuneCountInString(key)
+			if n, ok := findIndex(idx, key); ok {
+				weight = idx.weight(n)
+				count, at := idx.selections(n)
+				selections = s.decay(count, at, now)
+			}
+		}
+		candidates[i] = ranked{m, q.ranker.Rank(Candidate{
+			Word:       m.Word,
+			Meta:       m.Meta,
+			Distance:   m.Distance,
+			Fuzzy:      m.Fuzzy,
+			Exact:      m.Exact,
+			MidEntry:   m.MidEntry,
+			Weight:     weight,
+			Selections: selections,
+			Typed:      q.typedAs(search, m.Word),
+			Length:     length,
+		})}
+	}
+	slices.SortStableFunc(candidates, func(a, b ranked) int {
+		if c := slices.Compare(a.score, b.score); c != 0 {
+			return c
+		}
+		return strings.Compare(a.match.Word, b.match.Word)
+	})
+	for i, c := range candidates {
+		matches[i] = c.match
+	}
+	return matches
+}
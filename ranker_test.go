@@ -0,0 +1,72 @@
+package trie
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRanker(t *testing.T) {
+	t.Run("Default ranker keeps the default order", func(t *testing.T) {
+		tr := New()
+		tr.InsertWeighted("apricot", nil, 10)
+		tr.InsertWeighted("apple", nil, 1)
+		tr.Insert("april", "aple", "ample")
+		assert.Equal(t, tr.SearchAll("aple"), tr.SearchAll("aple", Ranking(DefaultRanker)))
+		assert.Equal(t, tr.Search("ap", 2), tr.Search("ap", 2, Ranking(DefaultRanker)))
+	})
+
+	t.Run("Custom ranker", func(t *testing.T) {
+		shortest := RankerFunc(func(c Candidate) []float64 {
+			return []float64{float64(utf8.RuneCountInString(c.Word))}
+		})
+		tr := New()
+		tr.InsertWeighted("application", nil, 10)
+		tr.Insert("apple", "app", "apply")
+		assert.Equal(t, []string{"app", "apple", "apply", "application"}, tr.SearchAll("app", Ranking(shortest)))
+		assert.Equal(t, []string{"app", "apple"}, tr.Search("app", 2, Ranking(shortest)))
+		assert.Equal(t, []string{"app", "application"}, tr.Search("app", 2))
+	})
+
+	t.Run("Candidate details", func(t *testing.T) {
+		var seen []Candidate
+		record := RankerFunc(func(c Candidate) []float64 {
+			seen = append(seen, c)
+			return nil
+		})
+		tr := New()
+		tr.InsertWeighted("Apple", "fruit", 3)
+		tr.SearchAll("apple", Ranking(record))
+		assert.Equal(t, []Candidate{{Word: "Apple", Meta: "fruit", Exact: true, Weight: 3, Length: 5}}, seen)
+	})
+
+	t.Run("Candidates of stricter multi-term searches", func(t *testing.T) {
+		var weights []float64
+		record := RankerFunc(func(c Candidate) []float64 {
+			weights = append(weights, c.Weight)
+			return nil
+		})
+		tr, err := NewWithOptions(WordStarts(true))
+		assert.NoError(t, err)
+		tr.InsertWeighted("Red Apple", nil, 1)
+		assert.Equal(t, []string{"Red Apple"}, tr.SearchAll("Apple Re", AllTerms(true), CaseSensitivity(true), Ranking(record)))
+		assert.Equal(t, []float64{1}, weights)
+	})
+
+	t.Run("Ranker for a whole trie", func(t *testing.T) {
+		metaFirst := RankerFunc(func(c Candidate) []float64 {
+			return []float64{flag(c.Meta == nil)}
+		})
+		tr, err := NewWithOptions(Ranking(metaFirst))
+		assert.NoError(t, err)
+		tr.Insert("bar", "baz")
+		tr.InsertWithMeta("bay", 1)
+		assert.Equal(t, []string{"bay", "bar", "baz"}, tr.SearchAll("ba"))
+		assert.Equal(t, []string{"bar", "bay", "baz"}, tr.SearchAll("ba", Ranking(nil)))
+
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"bay", "bar"}, c.Search("ba", 2, Ranking(metaFirst)))
+	})
+}
@@ -0,0 +1,85 @@
+package trie
+
+// refiner matches the original forms of words with a search under settings stricter than those
+// of the index, which keep apart words that the index gave the same key. A form is matched as
+// a search of an index holding nothing but it would match it.
+type refiner struct {
+	s *settings
+	// typed is the search string as it was typed, and key its key under s.
+	typed, key  string
+	maxDistance uint8
+}
+
+// newRefiner returns a refiner matching search under the settings s.
+func newRefiner(s *settings, search string) *refiner {
+	key, err := s.key(search)
+	if err != nil {
+		key = ""
+	}
+	return &refiner{s: s, typed: search, key: key, maxDistance: s.maxDistance(key)}
+}
+
+// score reports whether the search matches word, and returns the distance, fuzziness and
+// exactness of the match in a score.
+func (rf *refiner) score(word string) (score, bool) {
+	key, err := rf.s.key(word)
+	if err != nil || rf.key == "" {
+		return score{}, false
+	}
+	sr := searcher[int]{idx: wordIndex([]rune(key)), c: newCollector[int](0), typed: rf.typed, s: rf.s}
+	sr.collect(rf.key, 0, nil, 0, rf.maxDistance, rf.s.fuzzy, false)
+	if hits := sr.c.sorted(); len(hits) > 0 {
+		return hits[0].score, true
+	}
+	return score{}, false
+}
+
+// midEntry is just like score, but matches the search with the start of the later words of
+// word, and returns the best of those matches.
+func (rf *refiner) midEntry(word string) (best score, ok bool) {
+	spans := wordSpans(word)
+	for i := 1; i < len(spans); i++ {
+		if sc, matched := rf.score(word[spans[i].Start:]); matched && (!ok || compareScores(sc, best) < 0) {
+			best, ok = sc, true
+		}
+	}
+	return best, ok
+}
+
+// wordIndex is an index holding the single word made of its runes. A node is the number of
+// runes of the word on the path to it.
+type wordIndex []rune
+
+func (wordIndex) root() int { return 0 }
+
+func (w wordIndex) child(n int, r rune) (int, bool) {
+	if n < len(w) && w[n] == r {
+		return n + 1, true
+	}
+	return 0, false
+}
+
+func (w wordIndex) appendChildren(edges []edge[int], n int, _ bool) []edge[int] {
+	if n < len(w) {
+		edges = append(edges, edge[int]{w[n], n + 1})
+	}
+	return edges
+}
+
+func (w wordIndex) terminal(n int) bool { return n == len(w) }
+
+func (w wordIndex) word(n int) string { return string(w[:n]) }
+
+func (wordIndex) weight(int) float64 { return 0 }
+
+func (wordIndex) maxWeight(int) float64 { return 0 }
+
+func (wordIndex) selections(int) (float64, int64) { return 0, 0 }
+
+func (wordIndex) maxSelections(int) float64 { return 0 }
+
+func (wordIndex) variants(int) []entry { return nil }
+
+func (wordIndex) meta(int) interface{} { return nil }
+
+func (wordIndex) starts() (index[int], bool) { return nil, false }
@@ -0,0 +1,502 @@
+package trie
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// contextCheckInterval is the number of nodes visited between checks of a search's context.
+const contextCheckInterval = 256
+
+// index is the read side of a node storage. The mutable Trie and the read-only Compact both
+// implement it, so that they share one search algorithm.
+type index[N any] interface {
+	root() N
+	child(n N, r rune) (N, bool)
+	// appendChildren appends the edges to the children of n, in rune order when sorted is set.
+	appendChildren(edges []edge[N], n N, sorted bool) []edge[N]
+	// terminal reports whether n is the end of a word.
+	terminal(n N) bool
+	word(n N) string
+	weight(n N) float64
+	// maxWeight is the highest weight of any word in the subtree rooted at n.
+	maxWeight(n N) float64
+	// selections returns the number of times the word of n was selected, decayed to the time
+	// of its latest selection in Unix nanoseconds.
+	selections(n N) (count float64, at int64)
+	// maxSelections is the highest undecayed selections of any word in the subtree rooted at n.
+	maxSelections(n N) float64
+	// variants are the original words of n with their metadata, if they can differ from its word.
+	variants(n N) []entry
+	// meta is the metadata of the word of n inserted last.
+	meta(n N) interface{}
+	// starts returns the index of the later words of the entries, if there is one. Its
+	// words are the keys of the later words, and their variants the keys of the entries.
+	starts() (index[N], bool)
+}
+
+// edge leads from a node to its child for a rune.
+type edge[N any] struct {
+	r    rune
+	node N
+}
+
+// searchIndex searches idx, indexed with the settings s, with opts applied to s and returns the
+// matches, with the words replaced by their original forms, best first. When ctx is done before
+// the search completes it returns the matches found so far together with the context's error.
+func searchIndex[N any](ctx context.Context, idx index[N], s *settings, search string, limit int, opts ...Option) ([]Match, error) {
+	q, err := s.withOptions(opts)
+	if err != nil {
+		return []Match{}, err
+	}
+	// a search stricter than the index finds the words with the keys of the index, and matches
+	// their original forms again with the keys of q
+	p := q
+	var rf *refiner
+	if q.stricterThan(s) && !q.allTerms {
+		lenient := *q
+		lenient.normalised, lenient.caseSensitive = s.normalised, s.caseSensitive
+		p, rf = &lenient, newRefiner(q, search)
+	}
+	// a ranker can only tell the best matches once it has seen all of them
+	searchLimit := limit
+	if q.ranker != nil {
+		searchLimit = 0
+	}
+	var results []Match
+	if q.allTerms {
+		results, err = searchTerms(ctx, idx, s, q, search, searchLimit)
+	} else {
+		results, err = searchPrefix(ctx, idx, p, search, searchLimit, rf)
+	}
+	if q.ranker != nil {
+		results = rankMatches(idx, s, q, search, results)
+		if limit > 0 && len(results) > limit {
+			results = results[:limit]
+		}
+	}
+	if q.highlight {
+		for i := range results {
+			results[i].Highlights = q.highlights(search, results[i])
+		}
+	}
+	return results, err
+}
+
+// searchPrefix searches idx with the settings s for the words starting like search, and the
+// words with a later word starting like it when s matches word starts. With rf, only the
+// original forms that rf matches are kept, with the score rf gives them.
+func searchPrefix[N any](ctx context.Context, idx index[N], s *settings, search string, limit int, rf *refiner) ([]Match, error) {
+	hits, err := collectHits(ctx, idx, s, search, limit, s.filter, rf)
+	// the original forms of a word that were not typed like search rank after those that were,
+	// and after the other words that score the same without them
+	type variant struct {
+		match Match
+		key   string
+		score score
+	}
+	variants := make([]variant, 0, len(hits))
+	for _, hit := range hits {
+		for _, v := range entries(idx, hit.node) {
+			if s.filter != nil && !s.filter(v.meta) {
+				continue
+			}
+			sc := hit.score
+			if rf != nil {
+				strict, ok := rf.score(v.word)
+				if !ok {
+					continue
+				}
+				sc.levenshtein, sc.fuzzy, sc.exact = strict.levenshtein, strict.fuzzy, strict.exact
+			}
+			sc.typed = s.typedAs(search, v.word)
+			variants = append(variants, variant{Match{
+				Word:     v.word,
+				Meta:     v.meta,
+				Distance: int(sc.levenshtein),
+				Fuzzy:    sc.fuzzy,
+				Exact:    sc.exact,
+			}, hit.word, sc})
+		}
+	}
+	slices.SortStableFunc(variants, func(a, b variant) int {
+		if c := compareScores(a.score, b.score); c != 0 {
+			return c
+		}
+		return strings.Compare(a.key, b.key)
+	})
+	results := make([]Match, len(variants))
+	for i, v := range variants {
+		results[i] = v.match
+	}
+	if starts, ok := idx.starts(); ok && s.wordStarts && err == nil && (limit <= 0 || len(results) < limit) {
+		results, err = appendWordStarts(ctx, idx, starts, s, search, hits, results, rf)
+	}
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, err
+}
+
+// appendWordStarts appends the matches of search at the start of a later word of an entry to
+// results, the matches of hits at the start of entries, leaving out the entries of hits. The
+// entries are ordered together by distance, by weight, by selections, by length and then by
+// key, whatever word of theirs matched. With rf, only the original forms that rf matches at a
+// later word are kept, with the score rf gives them.
+func appendWordStarts[N any](ctx context.Context, idx, starts index[N], s *settings, search string, hits []hit[N], results []Match, rf *refiner) ([]Match, error) {
+	type target struct {
+		key   string
+		entry entry
+		score score
+	}
+	// any word start can hold the best entry, so they are all collected
+	startHits, err := collectHits(ctx, starts, s, search, 0, nil, nil)
+	seen := make(map[string]bool, len(hits))
+	for _, hit := range hits {
+		seen[hit.word] = true
+	}
+	now := time.Now().UnixNano()
+	var targets []target
+	for _, hit := range startHits {
+		for _, v := range starts.variants(hit.node) {
+			n, ok := findIndex(idx, v.word)
+			if !ok || seen[v.word] {
+				continue
+			}
+			seen[v.word] = true
+			count, at := idx.selections(n)
+			sc := score{
+				levenshtein: hit.levenshtein,
+				fuzzy:       hit.fuzzy,
+				weight:      idx.weight(n),
+				selections:  s.decay(count, at, now),
+				length:      utf8.RuneCountInString(v.word),
+			}
+			for _, e := range entries(idx, n) {
+				if s.filter != nil && !s.filter(e.meta) {
+					continue
+				}
+				sc := sc
+				if rf != nil {
+					strict, ok := rf.midEntry(e.word)
+					if !ok {
+						continue
+					}
+					sc.levenshtein, sc.fuzzy = strict.levenshtein, strict.fuzzy
+				}
+				targets = append(targets, target{v.word, e, sc})
+			}
+		}
+	}
+	slices.SortStableFunc(targets, func(a, b target) int {
+		if c := compareScores(a.score, b.score); c != 0 {
+			return c
+		}
+		return strings.Compare(a.key, b.key)
+	})
+	for _, target := range targets {
+		results = append(results, Match{
+			Word:     target.entry.word,
+			Meta:     target.entry.meta,
+			Distance: int(target.score.levenshtein),
+			Fuzzy:    target.score.fuzzy,
+			MidEntry: true,
+		})
+	}
+	return results, err
+}
+
+// collectHits searches idx with the settings s and returns the hits best first. With keep, it
+// only collects the words with an original form whose metadata keep keeps. With rf, it only
+// collects the words with an original form that rf matches, scored like the best of them.
+func collectHits[N any](ctx context.Context, idx index[N], s *settings, search string, limit int, keep func(meta interface{}) bool, rf *refiner) ([]hit[N], error) {
+	if len(search) == 0 {
+		return nil, nil
+	}
+	typed := search
+	search, err := s.key(search)
+	if err != nil || len(search) == 0 {
+		return nil, nil
+	}
+	sr := searcher[N]{idx: idx, c: newCollector[N](limit), keep: keep, refine: rf, typed: typed, s: s, now: time.Now().UnixNano()}
+	if ctx.Done() != nil {
+		sr.ctx = ctx
+	}
+	// start the recursive function
+	sr.collect(search, idx.root(), nil, 0, s.maxDistance(search), s.fuzzy, false)
+	return sr.c.sorted(), sr.err
+}
+
+// findMeta returns the metadata of word in idx, indexed with the settings s. Of the words
+// sharing its key, it prefers the one inserted exactly as word, and else the one inserted last.
+func findMeta[N any](idx index[N], s *settings, word string) (interface{}, bool) {
+	key, err := s.key(word)
+	if err != nil {
+		return nil, false
+	}
+	n, ok := findIndex(idx, key)
+	if !ok {
+		return nil, false
+	}
+	for _, v := range idx.variants(n) {
+		if v.word == word {
+			return v.meta, true
+		}
+	}
+	return idx.meta(n), true
+}
+
+// findIndex returns the node of the exact key in idx.
+func findIndex[N any](idx index[N], key string) (N, bool) {
+	current := idx.root()
+	for _, r := range key {
+		next, ok := idx.child(current, r)
+		if !ok {
+			var zero N
+			return zero, false
+		}
+		current = next
+	}
+	return current, idx.terminal(current)
+}
+
+// searcher holds the state of a single search through an index.
+type searcher[N any] struct {
+	idx index[N]
+	c   *collector[N]
+	// edges is a stack of the children being visited at each level of the recursion.
+	edges []edge[N]
+	// ctx is checked every contextCheckInterval visited nodes, nil if it can never be done.
+	ctx   context.Context
+	steps int
+	err   error
+	// keep filters the words by their metadata when set, and rejected holds the words it left out.
+	keep     func(meta interface{}) bool
+	rejected map[string]bool
+	// refine matches the original forms of the words again when set, and refined holds the
+	// scores of the words it matched.
+	refine  *refiner
+	refined map[string]score
+	// typed is the search string as it was typed, before it was turned into a key.
+	typed string
+	// s are the settings of the search, and now the time selections are decayed to.
+	s   *settings
+	now int64
+}
+
+// stopped reports whether the search has to end early because its context is done.
+func (sr *searcher[N]) stopped() bool {
+	if sr.ctx == nil || sr.err != nil {
+		return sr.err != nil
+	}
+	sr.steps++
+	if sr.steps%contextCheckInterval == 0 {
+		sr.err = sr.ctx.Err()
+	}
+	return sr.err != nil
+}
+
+// children pushes the edges to the children of n onto the stack and returns their positions.
+// The caller pops them with sr.edges = sr.edges[:start] when done; deeper calls may grow the
+// stack, so the edges must be read through sr.edges on each use.
+func (sr *searcher[N]) children(n N, sorted bool) (start, end int) {
+	start = len(sr.edges)
+	sr.edges = sr.idx.appendChildren(sr.edges, n, sorted)
+	return start, len(sr.edges)
+}
+
+// collect is a recursive function that traverses the index and passes words from Word-final nodes which match the search
+// text to the collector. It handles substitution, insertion and deletion to the levenshtein distance limit and also
+// allows fuzzy search. prefix holds the path from the root to node.
+func (sr *searcher[N]) collect(word string, node N, prefix []byte, distance, maxDistance uint8, fuzzyAllowed, fuzzyUsed bool) {
+	if sr.stopped() {
+		return
+	}
+	// no word reached from here has a lower distance, is reached without skipping characters
+	// once some were skipped, has a higher weight, is shorter than prefix or sorts before it
+	bound := score{
+		levenshtein: distance,
+		fuzzy:       fuzzyUsed,
+		exact:       true,
+		typed:       true,
+		weight:      sr.idx.maxWeight(node),
+		selections:  sr.idx.maxSelections(node),
+		length:      utf8.RuneCount(prefix),
+	}
+	if sr.c.prunes(bound, prefix) {
+		return
+	}
+	if len(word) == 0 {
+		if sr.idx.terminal(node) {
+			sr.add(node, score{levenshtein: distance, fuzzy: fuzzyUsed, exact: true, weight: sr.idx.weight(node)})
+			sr.collectAllDescendentWords(node, prefix, distance, fuzzyUsed)
+			return
+		}
+		sr.collectAllDescendentWords(node, prefix, distance, fuzzyUsed)
+	}
+	character, size := utf8.DecodeRuneInString(word)
+	subword := word[size:]
+	// special rune for string collisions
+	if character == '*' {
+		sr.collect(subword, node, prefix, distance, maxDistance, false, fuzzyUsed)
+	}
+
+	if next, ok := sr.idx.child(node, character); ok {
+		sr.collect(subword, next, utf8.AppendRune(prefix, character), distance, maxDistance, false, fuzzyUsed)
+	}
+
+	if distance < maxDistance {
+		// every word reached by an edit has a higher distance, so none of them can rank once
+		// the bound raised by one is pruned
+		bound.levenshtein, bound.fuzzy = distance+1, false
+		edits := !sr.c.prunes(bound, prefix)
+		if !edits && !fuzzyAllowed {
+			return
+		}
+		distance++
+
+		start, end := sr.children(node, false)
+		for i := start; i < end; i++ {
+			character, next := sr.edges[i].r, sr.edges[i].node
+			if edits {
+				// Substition
+				sr.collect(string(character)+subword, node, prefix, distance, maxDistance, false, fuzzyUsed)
+				// Insertion
+				sr.collect(string(character)+word, node, prefix, distance, maxDistance, false, fuzzyUsed)
+			}
+			// Fuzzy
+			if fuzzyAllowed {
+				sr.collect(word, next, utf8.AppendRune(prefix, character), distance-1, maxDistance, true, true)
+			}
+		}
+		sr.edges = sr.edges[:start]
+		// Deletion
+		if edits {
+			sr.collect(subword, node, prefix, distance, maxDistance, false, false)
+		}
+	} else if distance == 0 && fuzzyAllowed {
+		start, end := sr.children(node, false)
+		for i := start; i < end; i++ {
+			// Fuzzy without levenshtein
+			sr.collect(word, sr.edges[i].node, utf8.AppendRune(prefix, sr.edges[i].r), distance, maxDistance, true, true)
+		}
+		sr.edges = sr.edges[:start]
+	}
+}
+
+// collectAllDescendentWords adds the words from all nodes that are descendent of n.
+// A limited search visits children in rune order, so that once the collector is full
+// the remaining siblings are usually pruned straight away.
+func (sr *searcher[N]) collectAllDescendentWords(n N, prefix []byte, distance uint8, fuzzyUsed bool) {
+	if sr.stopped() {
+		return
+	}
+	start, end := sr.children(n, sr.c.limit > 0)
+	for i := start; i < end; i++ {
+		child := sr.edges[i].node
+		path := utf8.AppendRune(prefix, sr.edges[i].r)
+		bound := score{
+			levenshtein: distance,
+			fuzzy:       fuzzyUsed,
+			typed:       true,
+			weight:      sr.idx.maxWeight(child),
+			selections:  sr.idx.maxSelections(child),
+			length:      utf8.RuneCount(path),
+		}
+		if sr.c.prunes(bound, path) {
+			continue
+		}
+		if sr.idx.terminal(child) {
+			sr.add(child, score{levenshtein: distance, fuzzy: fuzzyUsed, weight: sr.idx.weight(child)})
+		}
+		sr.collectAllDescendentWords(child, path, distance, fuzzyUsed)
+	}
+	sr.edges = sr.edges[:start]
+}
+
+// add passes the word of n, reached with score sc, to the collector, unless the filter of the
+// search leaves out all of its original forms or a refined search matches none of them.
+func (sr *searcher[N]) add(n N, sc score) {
+	word := sr.idx.word(n)
+	if sr.rejected[word] {
+		return
+	}
+	sc.length = utf8.RuneCountInString(word)
+	count, at := sr.idx.selections(n)
+	sc.selections = sr.s.decay(count, at, sr.now)
+	if sr.refine != nil {
+		sr.addRefined(n, word, sc)
+		return
+	}
+	// only the original forms keep keeps can make the word typed as searched
+	kept := sr.keep == nil
+	for _, v := range entries(sr.idx, n) {
+		if sr.keep == nil || sr.keep(v.meta) {
+			kept = true
+			if strings.HasPrefix(v.word, sr.typed) {
+				sc.typed = true
+				break
+			}
+		}
+	}
+	if !kept {
+		if sr.rejected == nil {
+			sr.rejected = make(map[string]bool)
+		}
+		sr.rejected[word] = true
+		return
+	}
+	sr.c.add(n, word, sc)
+}
+
+// addRefined passes the word of n to the collector with the best score that sr.refine gives
+// its original forms in place of sc, unless it matches none of those keep keeps.
+func (sr *searcher[N]) addRefined(n N, word string, sc score) {
+	best, ok := sr.refined[word]
+	if !ok {
+		for _, v := range entries(sr.idx, n) {
+			if sr.keep != nil && !sr.keep(v.meta) {
+				continue
+			}
+			strict, matched := sr.refine.score(v.word)
+			if !matched {
+				continue
+			}
+			vs := sc
+			vs.levenshtein, vs.fuzzy, vs.exact = strict.levenshtein, strict.fuzzy, strict.exact
+			vs.typed = strings.HasPrefix(v.word, sr.typed)
+			if !ok || compareScores(vs, best) < 0 {
+				best, ok = vs, true
+			}
+		}
+		if !ok {
+			if sr.rejected == nil {
+				sr.rejected = make(map[string]bool)
+			}
+			sr.rejected[word] = true
+			return
+		}
+		if sr.refined == nil {
+			sr.refined = make(map[string]score)
+		}
+		sr.refined[word] = best
+	}
+	sr.c.add(n, word, best)
+}
+
+// typedAs reports whether word starts with search exactly as it was typed, in case and accents,
+// or with AllTerms, whether it holds every term of search as it was typed.
+func (s *settings) typedAs(search, word string) bool {
+	if !s.allTerms {
+		return strings.HasPrefix(word, search)
+	}
+	for _, term := range strings.FieldsFunc(search, isSeparator) {
+		if !strings.Contains(word, term) {
+			return false
+		}
+	}
+	return true
+}
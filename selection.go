@@ -0,0 +1,120 @@
+package trie
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrInvalidHalfLife is returned for a negative half-life of selections.
+var ErrInvalidHalfLife = errors.New("trie: invalid selection half-life")
+
+// SelectionDecay sets the time after which a selection recorded with RecordSelection counts
+// half as much, so that the ranking follows what is selected lately. A half-life of zero, the
+// default, keeps every selection at full count. It only applies to a whole trie, set with
+// NewWithOptions or Reconfigure, and not to a single search: the selections of a word are kept
+// as a single count, and a selection is added to it decayed with the half-life of the trie.
+// Reconfigure leaves the counts as they are and decays them with the new half-life from then on.
+func SelectionDecay(halfLife time.Duration) Option {
+	return func(s *settings) error {
+		if halfLife < 0 {
+			return ErrInvalidHalfLife
+		}
+		s.halfLife = halfLife
+		return nil
+	}
+}
+
+// RecordSelection records that the word was selected from the results of a search, such as a
+// suggestion a user picked. The words sharing its key are ranked by the number of times they
+// were selected, decayed with the half-life of SelectionDecay, after their weight and before
+// the casing and length of the words. It reports whether the word was found.
+//
+// The count belongs to the word and not to the search it was picked from, so a selection ranks
+// the word higher in every search that finds it. Counts per search string would grow with every
+// prefix users type and leave most searches without any selections to rank by.
+func (t *Trie) RecordSelection(word string) bool {
+	return t.RecordSelectionAt(word, time.Now())
+}
+
+// RecordSelectionAt is just like RecordSelection, but records the selection as made at the
+// time at, such as when selections are replayed from a log.
+func (t *Trie) RecordSelectionAt(word string, at time.Time) bool {
+	t.lock()
+	defer t.mu.Unlock()
+	key, err := t.key(word)
+	if err != nil {
+		return false
+	}
+	if _, ok := findIndex[*node](trieIndex{t}, key); !ok {
+		return false
+	}
+	// traverse to the node, copying the nodes shared with a snapshot
+	t.root = t.own(t.root)
+	path := []*node{t.root}
+	current := t.root
+	for _, r := range key {
+		next := t.own(current.children[r])
+		current.children[r] = next
+		current = next
+		path = append(path, current)
+	}
+	current.addSelections(1, at.UnixNano(), t.halfLife)
+	for _, n := range path {
+		n.maxSelections = max(n.maxSelections, current.selections)
+	}
+	return true
+}
+
+// keepSelections gives the word, which must be in t, count selections made at the time at in
+// Unix nanoseconds, unless it has more of its own.
+func (t *Trie) keepSelections(word string, count float64, at int64) {
+	key, err := t.key(word)
+	if err != nil {
+		return
+	}
+	path := t.path(key)
+	n := path[len(path)-1]
+	n.keepSelections(count, at, t.halfLife)
+	for _, p := range path {
+		p.maxSelections = max(p.maxSelections, n.selections)
+	}
+}
+
+// addSelections adds count selections, made at the time at in Unix nanoseconds, to the word
+// of n, decaying the older of them with halfLife.
+func (n *node) addSelections(count float64, at int64, halfLife time.Duration) {
+	if at >= n.selectedAt || n.selections == 0 {
+		n.selections = decay(n.selections, n.selectedAt, at, halfLife) + count
+		n.selectedAt = at
+		return
+	}
+	n.selections += decay(count, at, n.selectedAt, halfLife)
+}
+
+// keepSelections keeps the higher of the selections of n and count selections made at the
+// time at, once both are decayed to the later of their times with halfLife.
+func (n *node) keepSelections(count float64, at int64, halfLife time.Duration) {
+	if count == 0 {
+		return
+	}
+	later := max(at, n.selectedAt)
+	if n.selections == 0 || decay(count, at, later, halfLife) > decay(n.selections, n.selectedAt, later, halfLife) {
+		n.selections, n.selectedAt = count, at
+	}
+}
+
+// decay returns count selections, decayed to the time at in Unix nanoseconds, decayed further
+// to the time now with the half-life of s.
+func (s *settings) decay(count float64, at, now int64) float64 {
+	return decay(count, at, now, s.halfLife)
+}
+
+// decay returns count, decayed from the time at to the time now with halfLife, or count itself
+// if halfLife is zero or now is not later than at.
+func decay(count float64, at, now int64, halfLife time.Duration) float64 {
+	if halfLife <= 0 || now <= at || count == 0 {
+		return count
+	}
+	return count * math.Exp2(-float64(now-at)/float64(halfLife))
+}
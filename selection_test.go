@@ -0,0 +1,152 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelections(t *testing.T) {
+	t.Run("Selected words rank first", func(t *testing.T) {
+		tr := New()
+		tr.Insert("hello", "help", "helmet")
+		assert.Equal(t, []string{"help", "hello", "helmet"}, tr.SearchAll("hel"))
+		assert.True(t, tr.RecordSelection("helmet"))
+		assert.True(t, tr.RecordSelection("Hello"))
+		assert.True(t, tr.RecordSelection("hello"))
+		assert.Equal(t, []string{"hello", "helmet", "help"}, tr.SearchAll("hel"))
+		assert.Equal(t, []string{"hello"}, tr.Search("hel", 1))
+		assert.False(t, tr.RecordSelection("hel"))
+	})
+
+	t.Run("Weight outranks selections", func(t *testing.T) {
+		tr := New()
+		tr.InsertWeighted("apricot", nil, 1)
+		tr.Insert("apple")
+		tr.RecordSelection("apple")
+		assert.Equal(t, []string{"apricot", "apple"}, tr.SearchAll("ap"))
+	})
+
+	t.Run("Decay", func(t *testing.T) {
+		tr, err := NewWithOptions(SelectionDecay(time.Hour))
+		assert.NoError(t, err)
+		tr.Insert("hello", "help")
+		now := time.Now()
+		for i := 0; i < 3; i++ {
+			tr.RecordSelectionAt("hello", now.Add(-10*time.Hour))
+		}
+		tr.RecordSelectionAt("help", now.Add(-time.Minute))
+		assert.Equal(t, []string{"help", "hello"}, tr.SearchAll("hel"))
+		// the half-life is that of the trie
+		assert.Equal(t, []string{"help", "hello"}, tr.SearchAll("hel", SelectionDecay(0)))
+		// an older selection recorded later still counts as old
+		tr.RecordSelectionAt("hello", now.Add(-20*time.Hour))
+		assert.Equal(t, []string{"help"}, tr.Search("hel", 1))
+		assert.NoError(t, tr.Reconfigure(SelectionDecay(0)))
+		assert.Equal(t, []string{"hello", "help"}, tr.SearchAll("hel"))
+
+		_, err = NewWithOptions(SelectionDecay(-time.Hour))
+		assert.True(t, errors.Is(err, ErrInvalidHalfLife))
+	})
+
+	t.Run("Ranker candidates", func(t *testing.T) {
+		tr := New()
+		tr.Insert("hello")
+		tr.RecordSelection("hello")
+		tr.RecordSelection("hello")
+		var selections []float64
+		tr.SearchAll("hel", Ranking(RankerFunc(func(c Candidate) []float64 {
+			selections = append(selections, c.Selections)
+			return nil
+		})))
+		assert.Equal(t, []float64{2}, selections)
+	})
+
+	t.Run("Delete forgets selections", func(t *testing.T) {
+		tr := New()
+		tr.Insert("hello", "help")
+		tr.RecordSelection("hello")
+		tr.Delete("hello")
+		tr.Insert("hello")
+		assert.Equal(t, []string{"help", "hello"}, tr.SearchAll("hel"))
+		assert.Equal(t, 0.0, tr.root.maxSelections)
+	})
+
+	t.Run("Snapshots, compact indexes and reconfiguration", func(t *testing.T) {
+		tr, err := NewWithOptions(SelectionDecay(time.Hour))
+		assert.NoError(t, err)
+		tr.Insert("hello", "help", "Helmet")
+		now := time.Now()
+		tr.RecordSelectionAt("hello", now.Add(-10*time.Hour))
+		tr.RecordSelectionAt("hello", now.Add(-10*time.Hour))
+		tr.RecordSelectionAt("Helmet", now)
+		expected := []string{"Helmet", "hello", "help"}
+		assert.Equal(t, expected, tr.SearchAll("hel"))
+
+		var buf bytes.Buffer
+		_, err = tr.WriteTo(&buf)
+		assert.NoError(t, err)
+		loaded := New()
+		_, err = loaded.ReadFrom(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, time.Hour, loaded.halfLife)
+		assert.Equal(t, expected, loaded.SearchAll("hel"))
+
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, c.SearchAll("hel"))
+		assert.Equal(t, expected[:2], c.Search("hel", 2, SelectionDecay(0)))
+
+		assert.NoError(t, tr.Reconfigure(WordStarts(true)))
+		assert.Equal(t, expected, tr.SearchAll("hel"))
+		assert.NoError(t, tr.Reconfigure(CaseSensitivity(true)))
+		assert.Equal(t, []string{"hello", "help"}, tr.SearchAll("hel", Levenshtein(map[uint8]uint8{0: 0})))
+	})
+
+	t.Run("Snapshots of a Persistent stay unchanged", func(t *testing.T) {
+		p := NewPersistent()
+		p.Insert("hello", "help")
+		before := p.Snapshot()
+		p.Update(func(t *Trie) { t.RecordSelection("hello") })
+		assert.Equal(t, []string{"help", "hello"}, before.SearchAll("hel"))
+		assert.Equal(t, []string{"hello", "help"}, p.SearchAll("hel"))
+	})
+
+	t.Run("Limited search matches unlimited search", func(t *testing.T) {
+		rnd := rand.New(rand.NewSource(3))
+		letters := []rune("abcdeé")
+		tr, err := NewWithOptions(SelectionDecay(time.Hour))
+		assert.NoError(t, err)
+		var words []string
+		for i := 0; i < 1000; i++ {
+			word := make([]rune, 1+rnd.Intn(7))
+			for j := range word {
+				word[j] = letters[rnd.Intn(len(letters))]
+			}
+			words = append(words, string(word))
+			tr.Insert(string(word))
+		}
+		now := time.Now()
+		for i := 0; i < 2000; i++ {
+			tr.RecordSelectionAt(words[rnd.Intn(len(words))], now.Add(-time.Duration(rnd.Intn(100))*time.Hour))
+		}
+		for i := 0; i < 100; i++ {
+			query := make([]rune, 1+rnd.Intn(6))
+			for j := range query {
+				query[j] = letters[rnd.Intn(len(letters))]
+			}
+			all := tr.SearchAll(string(query))
+			for _, limit := range []int{1, 3, 10} {
+				expected := all
+				if len(expected) > limit {
+					expected = expected[:limit]
+				}
+				assert.Equal(t, expected, tr.Search(string(query), limit), "%s limit %d", string(query), limit)
+			}
+		}
+	})
+}
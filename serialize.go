@@ -0,0 +1,473 @@
+package trie
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+)
+
+// Snapshot layout, all integers are unsigned varints unless noted:
+//
+//	magic     "GATRIE"
+//	version   snapshotVersion
+//	flags     flag* bits, a single byte of version1Flags in version 1
+//	scheme    number of pairs, then a search string length byte and a distance byte per pair
+//	language  length-prefixed BCP 47 tag of the casing rules, empty for none, since version 2
+//	half-life nanoseconds after which a selection counts half, since version 2
+//	root      node
+//
+// where a node is
+//
+//	terminal  one byte, 1 when the node ends a word
+//	weight    8 byte little endian float64, terminal nodes only
+//	selected  8 byte little endian float64 selections and int64 Unix nanoseconds of the latest
+//	          one, terminal nodes only, since version 2
+//	meta      length+1 followed by the codec's bytes, or 0 for nil meta, terminal nodes only
+//	originals count followed by a length-prefixed string and a meta per original, terminal
+//	          nodes only; version 1 snapshots have no meta per original
+//	children  count followed by a rune and a node per child, in rune order
+//
+// The word of a terminal node is not stored, it is the path of runes leading to it. In
+// version 1 case insensitive keys were lower cased rather than case folded, so such snapshots
+// are indexed again from their originals when they are read.
+const (
+	snapshotMagic   = "GATRIE"
+	snapshotVersion = 2
+
+	flagFuzzy         = 1 << 0
+	flagNormalised    = 1 << 1
+	flagCaseSensitive = 1 << 2
+	// flagCustomNormaliser marks an index whose keys were made by a custom Normaliser.
+	flagCustomNormaliser = 1 << 3
+	// flagCompatible marks an index whose keys were made with compatibility normalisation.
+	flagCompatible = 1 << 4
+	// flagPunctuationCollapsed and flagPunctuationStripped store the PunctuationMode.
+	flagPunctuationCollapsed = 1 << 5
+	flagPunctuationStripped  = 1 << 6
+	// flagWordStarts marks an index matching the start of every word. The word starts are
+	// not stored, but indexed again when the snapshot is read.
+	flagWordStarts = 1 << 7
+	// flagAllTerms marks an index searched with AllTerms by default.
+	flagAllTerms = 1 << 8
+	// flagHighlight marks an index searched with Highlight by default.
+	flagHighlight = 1 << 9
+
+	// knownFlags are the flags read by this version, and version1Flags those of version 1
+	// snapshots. Flags that change how keys are built need a new version, so that readers
+	// that do not know them reject the index rather than search it with other keys.
+	knownFlags = flagFuzzy | flagNormalised | flagCaseSensitive | flagCustomNormaliser | flagCompatible |
+		flagPunctuationCollapsed | flagPunctuationStripped | flagWordStarts | flagAllTerms | flagHighlight
+	version1Flags = flagFuzzy | flagNormalised | flagCaseSensitive
+
+	// maxSnapshotLength guards against allocating huge buffers for corrupt lengths.
+	maxSnapshotLength = 1 << 30
+)
+
+// ErrInvalidSnapshot is returned by ReadFrom when its input is not a snapshot written by WriteTo.
+var ErrInvalidSnapshot = errors.New("trie: invalid snapshot")
+
+// MetaCodec converts the metadata stored with each entry to and from bytes when a Trie is
+// written with WriteTo and read back with ReadFrom. Nil metadata is never passed to a codec.
+type MetaCodec interface {
+	EncodeMeta(meta interface{}) ([]byte, error)
+	DecodeMeta(data []byte) (interface{}, error)
+}
+
+// GobCodec is the default MetaCodec of a Trie. It encodes metadata with encoding/gob as interface
+// values, so concrete types other than the basic ones must be registered with gob.Register.
+type GobCodec struct{}
+
+// EncodeMeta implements MetaCodec.
+func (GobCodec) EncodeMeta(meta interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&meta); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeMeta implements MetaCodec.
+func (GobCodec) DecodeMeta(data []byte) (interface{}, error) {
+	var meta interface{}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&meta)
+	return meta, err
+}
+
+// TypedGobCodec is the default MetaCodec of a GTrie[T]. It encodes metadata with encoding/gob as
+// values of type T, which need no registration.
+type TypedGobCodec[T any] struct{}
+
+// EncodeMeta implements MetaCodec.
+func (TypedGobCodec[T]) EncodeMeta(meta interface{}) ([]byte, error) {
+	v, ok := meta.(T)
+	if !ok {
+		return nil, fmt.Errorf("trie: metadata of type %T is not a %T", meta, v)
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeMeta implements MetaCodec.
+func (TypedGobCodec[T]) DecodeMeta(data []byte) (interface{}, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// WithMetaCodec sets the codec used for metadata by WriteTo and ReadFrom.
+func (t *Trie) WithMetaCodec(codec MetaCodec) *Trie {
+	t.lock()
+	defer t.mu.Unlock()
+	t.metaCodec = codec
+	return t
+}
+
+func (t *Trie) codec() MetaCodec {
+	if t.metaCodec == nil {
+		return GobCodec{}
+	}
+	return t.metaCodec
+}
+
+// WriteTo writes a versioned binary snapshot of the trie to w, including its settings, so that
+// ReadFrom can restore it without inserting every entry again. It implements io.WriterTo.
+func (t *Trie) WriteTo(w io.Writer) (int64, error) {
+	t.rlock()
+	defer t.runlock()
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+	sw := snapshotWriter{w: cw, codec: t.codec()}
+	sw.writeString(snapshotMagic)
+	sw.writeUvarint(snapshotVersion)
+	sw.writeUvarint(uint64(t.flags()))
+	lengths := make([]uint8, 0, len(t.levenshteinScheme))
+	for length := range t.levenshteinScheme {
+		lengths = append(lengths, length)
+	}
+	slices.Sort(lengths)
+	sw.writeUvarint(uint64(len(lengths)))
+	for _, length := range lengths {
+		sw.writeByte(length)
+		sw.writeByte(t.levenshteinScheme[length])
+	}
+	sw.writeUvarint(uint64(len(languageString(t.language))))
+	sw.writeString(languageString(t.language))
+	sw.writeUvarint(uint64(t.halfLife))
+	sw.writeNode(t.root)
+	if sw.err == nil {
+		sw.err = bw.Flush()
+	}
+	return cw.n, sw.err
+}
+
+// ReadFrom replaces the contents and settings of the trie with a snapshot written by WriteTo.
+// Metadata is decoded with the trie's own codec. It implements io.ReaderFrom.
+func (t *Trie) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	if br, ok := r.(io.ByteReader); ok {
+		cr.br = br
+	} else {
+		buffered := bufio.NewReader(r)
+		cr.r, cr.br = buffered, buffered
+	}
+	sr := snapshotReader{r: cr, codec: t.codec()}
+	if magic := sr.readBytes(uint64(len(snapshotMagic))); sr.err == nil && string(magic) != snapshotMagic {
+		return cr.n, fmt.Errorf("%w: bad magic", ErrInvalidSnapshot)
+	}
+	if sr.version = sr.readUvarint(); sr.err == nil && (sr.version == 0 || sr.version > snapshotVersion) {
+		return cr.n, fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, sr.version)
+	}
+	var flags uint32
+	if sr.version >= 2 {
+		flags = uint32(sr.readUvarint())
+	} else if flags = uint32(sr.readByte()); flags&^version1Flags != 0 {
+		return cr.n, fmt.Errorf("%w: unknown flags %#x", ErrInvalidSnapshot, flags&^version1Flags)
+	}
+	scheme := make(map[uint8]uint8)
+	for i, pairs := uint64(0), sr.readUvarint(); i < pairs && sr.err == nil; i++ {
+		length := sr.readByte()
+		scheme[length] = sr.readByte()
+	}
+	if _, ok := scheme[0]; sr.err == nil && !ok {
+		return cr.n, fmt.Errorf("%w: invalid levenshtein scheme", ErrInvalidSnapshot)
+	}
+	tag := language.Und
+	var halfLife time.Duration
+	if sr.version >= 2 {
+		var err error
+		if tag, err = parseLanguage(string(sr.readBytes(sr.readUvarint()))); sr.err == nil && err != nil {
+			return cr.n, fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+		}
+		if halfLife = time.Duration(sr.readUvarint()); sr.err == nil && halfLife < 0 {
+			return cr.n, fmt.Errorf("%w: %w", ErrInvalidSnapshot, ErrInvalidHalfLife)
+		}
+	}
+	root := sr.readNode(nil)
+	if sr.err != nil {
+		return cr.n, sr.err
+	}
+	if sr.version < 2 && flags&flagCaseSensitive == 0 {
+		rebuilt := New()
+		if err := rebuilt.setFlags(flags, ErrInvalidSnapshot); err != nil {
+			return cr.n, err
+		}
+		rebuilt.setLevenshtein(scheme)
+		if err := errors.Join(rebuilt.reindex(root)...); err != nil {
+			return cr.n, fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+		}
+		root = rebuilt.root
+	}
+
+	t.lock()
+	defer t.mu.Unlock()
+	if err := t.setFlags(flags, ErrInvalidSnapshot); err != nil {
+		return cr.n, err
+	}
+	root.gen = t.gen
+	t.root = root
+	t.language = tag
+	t.halfLife = halfLife
+	t.setLevenshtein(scheme)
+	t.starts = nil
+	if t.wordStarts {
+		t.indexAllWordStarts(root)
+	}
+	return cr.n, nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler using WriteTo.
+func (t *Trie) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := t.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler using ReadFrom.
+func (t *Trie) UnmarshalBinary(data []byte) error {
+	_, err := t.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// snapshotWriter writes the parts of a snapshot, remembering the first error.
+type snapshotWriter struct {
+	w     io.Writer
+	codec MetaCodec
+	buf   [binary.MaxVarintLen64]byte
+	err   error
+}
+
+func (sw *snapshotWriter) write(p []byte) {
+	if sw.err == nil {
+		_, sw.err = sw.w.Write(p)
+	}
+}
+
+func (sw *snapshotWriter) writeByte(b byte) {
+	sw.buf[0] = b
+	sw.write(sw.buf[:1])
+}
+
+func (sw *snapshotWriter) writeUvarint(v uint64) {
+	sw.write(sw.buf[:binary.PutUvarint(sw.buf[:], v)])
+}
+
+func (sw *snapshotWriter) writeString(s string) {
+	sw.write([]byte(s))
+}
+
+func (sw *snapshotWriter) writeMeta(meta interface{}) {
+	if meta == nil {
+		sw.writeUvarint(0)
+	} else if sw.err == nil {
+		var data []byte
+		data, sw.err = sw.codec.EncodeMeta(meta)
+		sw.writeUvarint(uint64(len(data)) + 1)
+		sw.write(data)
+	}
+}
+
+func (sw *snapshotWriter) writeNode(n *node) {
+	if n.word == "" {
+		sw.writeByte(0)
+	} else {
+		sw.writeByte(1)
+		binary.LittleEndian.PutUint64(sw.buf[:8], math.Float64bits(n.weight))
+		sw.write(sw.buf[:8])
+		binary.LittleEndian.PutUint64(sw.buf[:8], math.Float64bits(n.selections))
+		sw.write(sw.buf[:8])
+		binary.LittleEndian.PutUint64(sw.buf[:8], uint64(n.selectedAt))
+		sw.write(sw.buf[:8])
+		sw.writeMeta(n.meta)
+		sw.writeUvarint(uint64(len(n.variants)))
+		for _, v := range n.variants {
+			sw.writeUvarint(uint64(len(v.word)))
+			sw.writeString(v.word)
+			sw.writeMeta(v.meta)
+		}
+	}
+	keys := make([]rune, 0, len(n.children))
+	for character := range n.children {
+		keys = append(keys, character)
+	}
+	slices.Sort(keys)
+	sw.writeUvarint(uint64(len(keys)))
+	for _, character := range keys {
+		sw.writeUvarint(uint64(character))
+		sw.writeNode(n.children[character])
+	}
+}
+
+// snapshotReader reads the parts of a snapshot, remembering the first error.
+type snapshotReader struct {
+	r       *countingReader
+	codec   MetaCodec
+	version uint64
+	err     error
+}
+
+func (sr *snapshotReader) fail(err error) {
+	if sr.err != nil {
+		return
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	sr.err = err
+}
+
+func (sr *snapshotReader) readByte() byte {
+	if sr.err != nil {
+		return 0
+	}
+	b, err := sr.r.ReadByte()
+	sr.fail(err)
+	return b
+}
+
+func (sr *snapshotReader) readUvarint() uint64 {
+	if sr.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(sr.r)
+	sr.fail(err)
+	return v
+}
+
+func (sr *snapshotReader) readBytes(n uint64) []byte {
+	if sr.err != nil {
+		return nil
+	}
+	if n > maxSnapshotLength {
+		sr.fail(fmt.Errorf("%w: length %d too large", ErrInvalidSnapshot, n))
+		return nil
+	}
+	p := make([]byte, n)
+	_, err := io.ReadFull(sr.r, p)
+	sr.fail(err)
+	return p
+}
+
+func (sr *snapshotReader) readMeta() interface{} {
+	length := sr.readUvarint()
+	if length == 0 {
+		return nil
+	}
+	data := sr.readBytes(length - 1)
+	if sr.err != nil {
+		return nil
+	}
+	meta, err := sr.codec.DecodeMeta(data)
+	sr.fail(err)
+	return meta
+}
+
+// readNode reads a node and its descendants, whose path from the root is prefix.
+func (sr *snapshotReader) readNode(prefix []byte) *node {
+	n := &node{children: make(map[rune]*node)}
+	if terminal := sr.readByte(); terminal == 1 {
+		n.word = string(prefix)
+		var weight [8]byte
+		copy(weight[:], sr.readBytes(8))
+		n.weight = math.Float64frombits(binary.LittleEndian.Uint64(weight[:]))
+		if sr.version >= 2 {
+			var selected [16]byte
+			copy(selected[:], sr.readBytes(16))
+			n.selections = math.Float64frombits(binary.LittleEndian.Uint64(selected[:8]))
+			n.selectedAt = int64(binary.LittleEndian.Uint64(selected[8:]))
+			n.maxSelections = n.selections
+		}
+		n.meta = sr.readMeta()
+		count := sr.readUvarint()
+		for i := uint64(0); i < count && sr.err == nil; i++ {
+			v := entry{word: string(sr.readBytes(sr.readUvarint())), meta: n.meta}
+			if sr.version > 1 {
+				v.meta = sr.readMeta()
+			}
+			n.variants = append(n.variants, v)
+		}
+		n.maxWeight = n.weight
+	} else if terminal != 0 {
+		sr.fail(fmt.Errorf("%w: bad node", ErrInvalidSnapshot))
+	}
+	count := sr.readUvarint()
+	for i := uint64(0); i < count && sr.err == nil; i++ {
+		character := sr.readUvarint()
+		if character > utf8.MaxRune {
+			sr.fail(fmt.Errorf("%w: bad rune", ErrInvalidSnapshot))
+			break
+		}
+		child := sr.readNode(utf8.AppendRune(prefix, rune(character)))
+		if n.word == "" && len(n.children) == 0 || child.maxWeight > n.maxWeight {
+			n.maxWeight = child.maxWeight
+		}
+		n.maxSelections = max(n.maxSelections, child.maxSelections)
+		n.children[rune(character)] = child
+	}
+	return n
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r  io.Reader
+	br io.ByteReader
+	n  int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+func (cr *countingReader) ReadByte() (byte, error) {
+	b, err := cr.br.ReadByte()
+	if err == nil {
+		cr.n++
+	}
+	return b, err
+}
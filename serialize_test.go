@@ -0,0 +1,119 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	t.Run("Round trip", func(t *testing.T) {
+		tr := New()
+		tr.InsertWithMeta("Jürgen", "a")
+		tr.InsertWithMeta("jurgen", 2)
+		tr.InsertWeighted("Julia", nil, 3)
+		tr.Insert("hell", "hello")
+
+		var buf bytes.Buffer
+		n, err := tr.WriteTo(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(buf.Len()), n)
+
+		loaded := New()
+		read, err := loaded.ReadFrom(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, n, read)
+		assert.Equal(t, tr.SearchAllMeta("ju"), loaded.SearchAllMeta("ju"))
+		assert.Equal(t, []string{"hell", "hello"}, loaded.SearchAll("hel"))
+		meta, ok := loaded.FindMeta("jurgen")
+		assert.True(t, ok)
+		assert.Equal(t, 2, meta)
+	})
+
+	t.Run("Settings", func(t *testing.T) {
+		tr := New().WithoutFuzzy().CaseSensitive().CustomLevenshtein(map[uint8]uint8{0: 0, 4: 1})
+		tr.Insert("Hello")
+		data, err := tr.MarshalBinary()
+		assert.NoError(t, err)
+
+		loaded := New()
+		assert.NoError(t, loaded.UnmarshalBinary(data))
+		assert.False(t, loaded.fuzzy)
+		assert.True(t, loaded.caseSensitive)
+		assert.Equal(t, map[uint8]uint8{0: 0, 4: 1}, loaded.levenshteinScheme)
+		assert.Empty(t, loaded.SearchAll("hel"))
+		assert.Equal(t, []string{"Hello"}, loaded.SearchAll("Hallo"))
+	})
+
+	t.Run("Generic metadata", func(t *testing.T) {
+		g := NewG[Product]()
+		g.Insert("iPhone", Product{ID: 1, Price: 999})
+		data, err := g.MarshalBinary()
+		assert.NoError(t, err)
+
+		loaded := NewG[Product]()
+		assert.NoError(t, loaded.UnmarshalBinary(data))
+		p, ok := loaded.Find("iphone")
+		assert.True(t, ok)
+		assert.Equal(t, Product{ID: 1, Price: 999}, p)
+	})
+
+	t.Run("Version 1", func(t *testing.T) {
+		// "A" with the default settings, written before originals had their own metadata
+		data := []byte("GATRIE\x01\x03\x03\x00\x00\x03\x01\x05\x02\x00\x01a\x01" +
+			"\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x01A\x00")
+		loaded := New()
+		assert.NoError(t, loaded.UnmarshalBinary(data))
+		assert.Equal(t, []string{"A"}, loaded.SearchAll("a"))
+	})
+
+	t.Run("Unknown flags", func(t *testing.T) {
+		// an empty trie whose flags have a bit this version does not know
+		data := []byte("GATRIE\x02\x83\x10\x03\x00\x00\x03\x01\x05\x02\x00\x00\x00\x00")
+		err := New().UnmarshalBinary(data)
+		assert.True(t, errors.Is(err, ErrInvalidSnapshot))
+		// version 1 only had the flags of the default settings
+		data = []byte("GATRIE\x01\x83\x03\x00\x00\x03\x01\x05\x02\x00\x00")
+		err = New().UnmarshalBinary(data)
+		assert.True(t, errors.Is(err, ErrInvalidSnapshot))
+		data[7] = 0x03
+		assert.NoError(t, New().UnmarshalBinary(data))
+	})
+
+	t.Run("Invalid input", func(t *testing.T) {
+		tr := New()
+		tr.Insert("hello")
+		data, err := tr.MarshalBinary()
+		assert.NoError(t, err)
+
+		err = New().UnmarshalBinary([]byte("NOTATRIE"))
+		assert.True(t, errors.Is(err, ErrInvalidSnapshot))
+
+		version := append([]byte(nil), data...)
+		version[len(snapshotMagic)] = snapshotVersion + 1
+		err = New().UnmarshalBinary(version)
+		assert.True(t, errors.Is(err, ErrInvalidSnapshot))
+
+		err = New().UnmarshalBinary(data[:len(data)-3])
+		assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+	})
+}
+
+func BenchmarkReadFrom(b *testing.B) {
+	t := New()
+	t.Insert("Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday")
+	data, err := t.MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := New().UnmarshalBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package trie
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrAllTermsWithoutWordStarts is returned when AllTerms is set on an index without WordStarts.
+var ErrAllTermsWithoutWordStarts = errors.New("trie: AllTerms needs the index of WordStarts")
+
+// AllTerms turns multi-term searches on or off, off by default. The search string is split into
+// terms at whitespace and punctuation, and a word matches when every term matches a different
+// one of its words, in any order: the last term as a prefix and the others as whole words, so
+// "red app" finds "Apple Red Delicious". Each term is allowed the levenshtein distance that the
+// scheme gives its own length, and fuzzy matching does not apply. The Distance of a match is
+// the sum of the distances of its terms, and it is Exact when the terms make up all of Word.
+//
+// Entries are found by their later words through the index of WordStarts, which AllTerms
+// needs: NewWithOptions and Reconfigure return ErrAllTermsWithoutWordStarts when AllTerms is
+// set without WordStarts, and so does a search with AllTerms of an index without it.
+func AllTerms(enabled bool) Option {
+	return func(s *settings) error {
+		s.allTerms = enabled
+		return nil
+	}
+}
+
+// checkTerms returns ErrAllTermsWithoutWordStarts if s matches all terms without indexing the
+// later words of entries.
+func (s *settings) checkTerms() error {
+	if s.allTerms && !s.wordStarts {
+		return ErrAllTermsWithoutWordStarts
+	}
+	return nil
+}
+
+// terms returns the keys of the words of word, which are separated by whitespace and
+// punctuation, leaving out the words that have no key.
+func (s *settings) terms(word string) []string {
+	keys, _ := s.termSpans(word)
+	return keys
+}
+
+// termSpans is just like terms, but also returns the spans of the words in word.
+func (s *settings) termSpans(word string) (keys []string, spans []Span) {
+	for _, w := range wordSpans(word) {
+		if key, err := s.key(word[w.Start:w.End]); err == nil && key != "" {
+			keys = append(keys, key)
+			spans = append(spans, w)
+		}
+	}
+	return keys, spans
+}
+
+// searchTerms searches idx, indexed with the settings s, for the words matching every term of
+// search under the settings q, and returns the matches best first. When ctx is done before the
+// search completes it returns the matches found so far together with the context's error.
+func searchTerms[N any](ctx context.Context, idx index[N], s, q *settings, search string, limit int) ([]Match, error) {
+	terms := q.terms(search)
+	if len(terms) == 0 {
+		return []Match{}, nil
+	}
+	candidates, err := termCandidates(ctx, idx, s, q, search)
+	type scored struct {
+		match Match
+		score score
+	}
+	var found []scored
+	now := time.Now().UnixNano()
+	for _, n := range candidates {
+		// matching the terms against a candidate costs far more than visiting a node, so ctx is
+		// checked for every one
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			break
+		}
+		for _, v := range entries(idx, n) {
+			if q.filter != nil && !q.filter(v.meta) {
+				continue
+			}
+			distance, exact, ok := q.matchTerms(terms, v.word)
+			if !ok {
+				continue
+			}
+			count, at := idx.selections(n)
+			found = append(found, scored{
+				match: Match{Word: v.word, Meta: v.meta, Distance: distance, Exact: exact},
+				score: score{
+					levenshtein: uint8(min(distance, 255)),
+					exact:       exact,
+					weight:      idx.weight(n),
+					selections:  q.decay(count, at, now),
+					typed:       q.typedAs(search, v.word),
+					length:      utf8.RuneCountInString(idx.word(n)),
+				},
+			})
+		}
+	}
+	slices.SortFunc(found, func(a, b scored) int {
+		if rankedBefore(a.match.Word, a.score, b.match.Word, b.score) {
+			return -1
+		}
+		if rankedBefore(b.match.Word, b.score, a.match.Word, a.score) {
+			return 1
+		}
+		return 0
+	})
+	if limit > 0 && len(found) > limit {
+		found = found[:limit]
+	}
+	results := make([]Match, len(found))
+	for i, f := range found {
+		results[i] = f.match
+	}
+	return results, err
+}
+
+// termCandidates returns the nodes of idx, indexed with the settings s, that may match every
+// term of search under the settings q: those with a word starting like its longest term. It
+// returns ErrAllTermsWithoutWordStarts if the later words of entries are not indexed.
+func termCandidates[N any](ctx context.Context, idx index[N], s, q *settings, search string) ([]N, error) {
+	starts, ok := idx.starts()
+	if !ok {
+		return nil, ErrAllTermsWithoutWordStarts
+	}
+	longest := ""
+	for _, field := range strings.FieldsFunc(search, isSeparator) {
+		if utf8.RuneCountInString(field) > utf8.RuneCountInString(longest) {
+			longest = field
+		}
+	}
+	lenient := *q
+	lenient.normalised, lenient.caseSensitive, lenient.fuzzy = s.normalised, s.caseSensitive, false
+	hits, err := collectHits(ctx, idx, &lenient, longest, 0, q.filter, nil)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(hits))
+	nodes := make([]N, 0, len(hits))
+	for _, hit := range hits {
+		seen[hit.word] = true
+		nodes = append(nodes, hit.node)
+	}
+	startHits, err := collectHits(ctx, starts, &lenient, longest, 0, nil, nil)
+	for _, hit := range startHits {
+		for _, v := range starts.variants(hit.node) {
+			if n, ok := findIndex(idx, v.word); ok && !seen[v.word] {
+				seen[v.word] = true
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	return nodes, err
+}
+
+// entries returns the original forms of the word of n with their metadata.
+func entries[N any](idx index[N], n N) []entry {
+	if variants := idx.variants(n); len(variants) > 0 {
+		return variants
+	}
+	return []entry{{idx.word(n), idx.meta(n)}}
+}
+
+// matchTerms reports whether every term matches a different word of word within the distance
+// allowed for its length, the last one as a prefix, and returns the lowest sum of their
+// distances and whether the terms can match all of the words completely at that distance.
+func (s *settings) matchTerms(terms []string, word string) (distance int, exact, ok bool) {
+	words := s.terms(word)
+	_, distance, ok = s.assignTerms(terms, words, true)
+	if !ok {
+		return 0, false, false
+	}
+	if len(words) == len(terms) {
+		_, whole, wholeOK := s.assignTerms(terms, words, false)
+		exact = wholeOK && whole == distance
+	}
+	return distance, exact, true
+}
+
+// assignTerms assigns a different one of words to every term, so that the sum of their
+// distances is the lowest, and returns the index of the word of every term and the sum. Every
+// term has to match its word within the distance allowed for its length, the last one as a
+// prefix when prefix is set and the others as whole words.
+func (s *settings) assignTerms(terms, words []string, prefix bool) (assignment []int, distance int, ok bool) {
+	if len(words) < len(terms) {
+		return nil, 0, false
+	}
+	// rows holds the distance of each term to each word, or -1 where it is too high
+	rows := make([][]int, len(terms))
+	for i, term := range terms {
+		limit := int(s.maxDistance(term))
+		rows[i] = make([]int, len(words))
+		for j, w := range words {
+			d, prefixDistance := levenshtein(term, w)
+			if prefix && i == len(terms)-1 {
+				d = prefixDistance
+			}
+			if d > limit {
+				d = -1
+			}
+			rows[i][j] = d
+		}
+	}
+	return cheapestAssignment(rows)
+}
+
+// cheapestAssignment returns the assignment of a different word j to every term i with the
+// lowest sum of distances[i][j], where -1 marks a term and word that do not match, and the sum.
+// It is the Hungarian method, which takes time cubic in the number of words, with the pairs
+// that do not match costing more than any assignment of pairs that do.
+func cheapestAssignment(distances [][]int) (assignment []int, cost int, ok bool) {
+	terms := len(distances)
+	if terms == 0 {
+		return nil, 0, true
+	}
+	words := len(distances[0])
+	unmatched := 1
+	for _, row := range distances {
+		unmatched += slices.Max(row)
+	}
+	at := func(i, j int) int {
+		if d := distances[i-1][j-1]; d >= 0 {
+			return d
+		}
+		return unmatched
+	}
+	// the potentials of the terms and words, the term assigned to each word, 1-based with 0 for
+	// none, and the word before each on the shortest augmenting path
+	rowPotential, colPotential := make([]int, terms+1), make([]int, words+1)
+	termOf, previous := make([]int, words+1), make([]int, words+1)
+	slack, visited := make([]int, words+1), make([]bool, words+1)
+	for i := 1; i <= terms; i++ {
+		termOf[0] = i
+		free := 0
+		for j := range slack {
+			slack[j], visited[j] = math.MaxInt, false
+		}
+		for termOf[free] != 0 {
+			visited[free] = true
+			term, delta, next := termOf[free], math.MaxInt, 0
+			for j := 1; j <= words; j++ {
+				if visited[j] {
+					continue
+				}
+				if reduced := at(term, j) - rowPotential[term] - colPotential[j]; reduced < slack[j] {
+					slack[j], previous[j] = reduced, free
+				}
+				if slack[j] < delta {
+					delta, next = slack[j], j
+				}
+			}
+			for j := 0; j <= words; j++ {
+				if visited[j] {
+					rowPotential[termOf[j]] += delta
+					colPotential[j] -= delta
+				} else {
+					slack[j] -= delta
+				}
+			}
+			free = next
+		}
+		for free != 0 {
+			termOf[free] = termOf[previous[free]]
+			free = previous[free]
+		}
+	}
+	assignment = make([]int, terms)
+	for j := 1; j <= words; j++ {
+		if i := termOf[j]; i != 0 {
+			if distances[i-1][j-1] < 0 {
+				return nil, 0, false
+			}
+			assignment[i-1] = j - 1
+			cost += distances[i-1][j-1]
+		}
+	}
+	return assignment, cost, true
+}
+
+// levenshtein returns the levenshtein distance between a and b, and the lowest distance between
+// a and any prefix of b.
+func levenshtein(a, b string) (whole, prefix int) {
+	ra, rb := []rune(a), []rune(b)
+	row := make([]int, len(rb)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		diagonal := row[0]
+		row[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			diagonal, row[j] = row[j], min(row[j]+1, row[j-1]+1, diagonal+cost)
+		}
+	}
+	return row[len(rb)], slices.Min(row)
+}
@@ -0,0 +1,122 @@
+package trie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllTerms(t *testing.T) {
+	fruits := []string{"Apple Red Delicious", "Red Apple", "Apple Green", "Pineapple", "Red Currant"}
+
+	t.Run("Levenshtein", func(t *testing.T) {
+		for _, c := range []struct {
+			a, b          string
+			whole, prefix int
+		}{
+			{"app", "apple", 2, 0},
+			{"apl", "apple", 2, 1},
+			{"red", "red", 0, 0},
+			{"", "red", 3, 0},
+			{"delicous", "delicious", 1, 1},
+		} {
+			whole, prefix := levenshtein(c.a, c.b)
+			assert.Equal(t, c.whole, whole, c.a+" "+c.b)
+			assert.Equal(t, c.prefix, prefix, c.a+" "+c.b)
+		}
+	})
+
+	t.Run("Terms in any order", func(t *testing.T) {
+		tr, err := NewWithOptions(WordStarts(true))
+		assert.NoError(t, err)
+		tr.Insert(fruits...)
+		assert.Equal(t, []string{"Red Apple", "Apple Red Delicious"}, tr.SearchAll("red app", AllTerms(true)))
+		assert.Equal(t, []string{"Apple Red Delicious"}, tr.SearchAll("delicous red", AllTerms(true)))
+		// only the last term is a prefix
+		assert.Empty(t, tr.SearchAll("app red", AllTerms(true)))
+		// every term needs a word of its own
+		assert.Empty(t, tr.SearchAll("red red", AllTerms(true)))
+		assert.Equal(t, []string{"Red Apple", "Apple Green", "Apple Red Delicious"}, tr.SearchAll("apple", AllTerms(true)))
+		assert.Equal(t, []string{"Red Apple"}, tr.Search("red app", 1, AllTerms(true)))
+		assert.Empty(t, tr.SearchAll(" - ", AllTerms(true)))
+	})
+
+	t.Run("Without word starts", func(t *testing.T) {
+		_, err := NewWithOptions(AllTerms(true))
+		assert.True(t, errors.Is(err, ErrAllTermsWithoutWordStarts))
+
+		tr := New()
+		tr.Insert(fruits...)
+		_, err = tr.SearchContext(context.Background(), "red app", 0, AllTerms(true))
+		assert.True(t, errors.Is(err, ErrAllTermsWithoutWordStarts))
+
+		tr, err = NewWithOptions(AllTerms(true), WordStarts(true))
+		assert.NoError(t, err)
+		assert.True(t, errors.Is(tr.Reconfigure(WordStarts(false)), ErrAllTermsWithoutWordStarts))
+		assert.NoError(t, tr.Reconfigure(WordStarts(false), AllTerms(false)))
+	})
+
+	t.Run("Distance and exact matches", func(t *testing.T) {
+		tr, err := NewWithOptions(WordStarts(true))
+		assert.NoError(t, err)
+		tr.InsertWithMeta("Red Apple", 1)
+		tr.InsertWithMeta("Apple Red Delicious", 2)
+		assert.Equal(t, []Match{
+			{Word: "Red Apple", Meta: 1, Exact: true},
+			{Word: "Apple Red Delicious", Meta: 2},
+		}, tr.SearchAllMeta("apple red", AllTerms(true)))
+		assert.Equal(t, []Match{
+			{Word: "Red Apple", Meta: 1, Distance: 1},
+			{Word: "Apple Red Delicious", Meta: 2, Distance: 1},
+		}, tr.SearchAllMeta("aple re", AllTerms(true)))
+	})
+
+	t.Run("Stricter queries", func(t *testing.T) {
+		tr, err := NewWithOptions(WordStarts(true), Levenshtein(map[uint8]uint8{0: 0}))
+		assert.NoError(t, err)
+		tr.Insert("Red Apple", "red apple")
+		assert.Equal(t, []string{"Red Apple"}, tr.SearchAll("Red App", AllTerms(true), CaseSensitivity(true)))
+	})
+
+	t.Run("Many terms", func(t *testing.T) {
+		tr, err := NewWithOptions(WordStarts(true))
+		assert.NoError(t, err)
+		tr.Insert("alpha bravo charlie delta echo foxtrot golf hotel india juliet kilo lima mike november")
+		search := "november mike lima kilo juliet india hotel golf"
+		assert.Len(t, tr.SearchAll(search, AllTerms(true)), 1)
+		assert.Empty(t, tr.SearchAll(search+" zulu", AllTerms(true)))
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		tr, err := NewWithOptions(WordStarts(true))
+		assert.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			tr.Insert(fmt.Sprintf("red apple %d", i))
+		}
+		// finding the candidates checks the context ten times, and matching them once each
+		matches, err := tr.SearchContext(&stoppingContext{Context: context.Background(), calls: 13}, "apple red", 0, AllTerms(true))
+		assert.Equal(t, context.Canceled, err)
+		assert.Len(t, matches, 3)
+	})
+
+	t.Run("Compact indexes and trie settings", func(t *testing.T) {
+		tr, err := NewWithOptions(AllTerms(true), WordStarts(true))
+		assert.NoError(t, err)
+		tr.Insert(fruits...)
+		assert.Equal(t, []string{"Red Currant"}, tr.SearchAll("currant red"))
+		assert.Empty(t, tr.SearchAll("currant red", AllTerms(false)))
+
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		assert.Equal(t, tr.SearchAll("red app"), c.SearchAll("red app"))
+
+		data, err := tr.MarshalBinary()
+		assert.NoError(t, err)
+		loaded := New()
+		assert.NoError(t, loaded.UnmarshalBinary(data))
+		assert.True(t, loaded.allTerms)
+	})
+}
@@ -1,15 +1,18 @@
 package trie
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
 	"sort"
-	"strings"
 	"sync"
-	"unicode"
+	"sync/atomic"
+	"time"
 	"unicode/utf8"
 
-	"golang.org/x/text/runes"
-	"golang.org/x/text/transform"
-	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/language"
 )
 
 const (
@@ -24,25 +27,71 @@ const (
 
 // Trie is a data structure for storing common prefixes to strings for efficient comparison
 // and retrieval.
+//
+// A Trie is safe for concurrent use by multiple goroutines. Searches, lookups and snapshots
+// share a read lock and run in parallel, while inserts, deletes and the configuration methods
+// take the write lock, so every search sees the trie either before or after each change.
 type Trie struct {
-	root                             *node
-	mu                               sync.RWMutex
+	root *node
+	// starts is the root of the word starts, which lead from the keys of the later words of
+	// entries to the keys of the entries, when WordStarts is set.
+	starts *node
+	mu     sync.RWMutex
+	settings
+	// gen is the generation of the nodes this trie may change in place. Nodes of another
+	// generation are shared with a published snapshot and are copied before a change.
+	gen uint64
+	// shared is set when a snapshot holds the nodes of gen, so the next change moves on to a
+	// new generation.
+	shared atomic.Bool
+	// published is set once the trie is a snapshot of a Persistent and can no longer change.
+	published bool
+	// metaCodec encodes metadata for WriteTo and ReadFrom, GobCodec when nil.
+	metaCodec MetaCodec
+}
+
+// settings decide how words are indexed and matched.
+type settings struct {
 	fuzzy, normalised, caseSensitive bool
 	levenshteinScheme                map[uint8]uint8
 	levenshteinIntervals             []uint8
-	// originalDict is a mapping of normalised to original string.
-	originalDict map[string][]string
+	// normaliser replaces normalisation and case folding when set.
+	normaliser Normaliser
+	// language decides the casing rules of case folding, language.Und for the default ones.
+	language language.Tag
+	// compatible replaces compatibility characters, such as full-width letters, in keys.
+	compatible bool
+	// punctuation decides how whitespace and punctuation count in keys.
+	punctuation PunctuationMode
+	// wordStarts matches searches at the start of the later words of entries as well.
+	wordStarts bool
+	// allTerms matches every term of a search string with a different word of an entry.
+	allTerms bool
+	// highlight adds the spans of the words that searches matched to their matches.
+	highlight bool
+	// filter leaves the words whose metadata it does not keep out of searches when set.
+	filter func(meta interface{}) bool
+	// ranker orders the results of searches instead of the default order when set.
+	ranker Ranker
+	// halfLife is the time after which a selection counts half as much, zero if they never decay.
+	halfLife time.Duration
 }
 
 // GTrie is a generic wrapper around Trie storing typed metadata.
 type GTrie[T any] struct{ *Trie }
 
-// NewG creates a new generic trie.
-func NewG[T any]() *GTrie[T] { return &GTrie[T]{New()} }
+// NewG creates a new generic trie. Its metadata is serialised with encoding/gob as values of
+// type T, so T does not need to be registered with gob.Register.
+func NewG[T any]() *GTrie[T] { return &GTrie[T]{New().WithMetaCodec(TypedGobCodec[T]{})} }
 
 // Insert adds a word with typed metadata.
 func (g *GTrie[T]) Insert(key string, meta T) { g.InsertWithMeta(key, meta) }
 
+// InsertWeighted adds a word with typed metadata and a ranking weight.
+func (g *GTrie[T]) InsertWeighted(key string, meta T, weight float64) {
+	g.Trie.InsertWeighted(key, meta, weight)
+}
+
 // Find retrieves metadata for the given key.
 func (g *GTrie[T]) Find(key string) (T, bool) {
 	v, ok := g.FindMeta(key)
@@ -58,28 +107,33 @@ func (g *GTrie[T]) Find(key string) (T, bool) {
 	return meta, true
 }
 
-// SearchAll performs fuzzy search returning typed metadata.
-func (g *GTrie[T]) SearchAll(query string) []struct {
-	Word string
-	Meta T
-} {
-	raw := g.SearchAllMeta(query)
-	res := make([]struct {
-		Word string
-		Meta T
-	}, len(raw))
+// GMatch is a search hit with typed metadata. See Match for the meaning of the fields.
+type GMatch[T any] struct {
+	Word       string
+	Meta       T
+	Distance   int
+	Fuzzy      bool
+	Exact      bool
+	MidEntry   bool
+	Highlights []Span
+}
+
+// SearchAll performs fuzzy search returning typed metadata. It used to return anonymous structs
+// with only Word and Meta, which GMatch replaces.
+func (g *GTrie[T]) SearchAll(query string, opts ...Option) []GMatch[T] {
+	raw := g.SearchAllMeta(query, opts...)
+	res := make([]GMatch[T], len(raw))
 	for i, m := range raw {
+		res[i] = GMatch[T]{
+			Word:       m.Word,
+			Distance:   m.Distance,
+			Fuzzy:      m.Fuzzy,
+			Exact:      m.Exact,
+			MidEntry:   m.MidEntry,
+			Highlights: m.Highlights,
+		}
 		if v, ok := m.Meta.(T); ok {
-			res[i] = struct {
-				Word string
-				Meta T
-			}{Word: m.Word, Meta: v}
-		} else {
-			var zero T
-			res[i] = struct {
-				Word string
-				Meta T
-			}{Word: m.Word, Meta: zero}
+			res[i].Meta = v
 		}
 	}
 	return res
@@ -90,23 +144,69 @@ func (g *GTrie[T]) SearchAll(query string) []struct {
 type node struct {
 	children map[rune]*node
 	word     string
-	meta     interface{}
+	// variants are the words that were inserted with word as their key, with their metadata.
+	variants []entry
+	// start holds the entries of a word start node, nil for other nodes.
+	start *wordStart
+	// meta is the metadata of the word inserted last.
+	meta   interface{}
+	weight float64
+	// maxWeight is the highest weight of any word in the subtree rooted at this node.
+	maxWeight float64
+	// selections is the number of times the word was selected, decayed to selectedAt, the time
+	// of its latest selection in Unix nanoseconds.
+	selections float64
+	selectedAt int64
+	// maxSelections is the highest selections of any word in the subtree rooted at this node,
+	// which is at least as high as any of them decays to.
+	maxSelections float64
+	// gen is the generation of the trie that created the node.
+	gen uint64
 }
 
 type score struct {
 	levenshtein uint8
 	fuzzy       bool
+	exact       bool
+	weight      float64
+	// selections is the number of times the word was selected, decayed to the time of the search.
+	selections float64
+	// typed reports whether an original form of the word starts with the search string
+	// exactly as it was typed, in case and accents.
+	typed bool
+	// length is the number of runes of the key of the word.
+	length int
+}
+
+// improves reports whether s is a better way of reaching the same word than previous.
+func (s score) improves(previous score) bool {
+	switch {
+	case s.levenshtein != previous.levenshtein:
+		return s.levenshtein < previous.levenshtein
+	case s.fuzzy != previous.fuzzy:
+		return !s.fuzzy
+	default:
+		return s.exact && !previous.exact
+	}
 }
 
 // Match represents a fuzzy search hit with its metadata.
 type Match struct {
 	Word string
 	Meta interface{}
-}
-
-type matchScore struct {
-	score
-	meta interface{}
+	// Distance is the levenshtein distance between the search string and the matched part of Word.
+	Distance int
+	// Fuzzy reports whether characters of Word were skipped over to find the match.
+	Fuzzy bool
+	// Exact reports whether the search string matched the whole of Word, rather than it being
+	// a completion of a matched prefix.
+	Exact bool
+	// MidEntry reports whether the search string matched the start of a later word of Word
+	// rather than the start of Word, with the WordStarts option.
+	MidEntry bool
+	// Highlights are the parts of Word that the search string matched, in order, with the
+	// Highlight option.
+	Highlights []Span
 }
 
 // New creates a new empty trie. By default fuzzy search is on and string normalisation is on.
@@ -117,7 +217,6 @@ func New() *Trie {
 	t := new(Trie)
 	t.root = new(node)
 	t.root.children = make(map[rune]*node)
-	t.originalDict = make(map[string][]string)
 	t.WithFuzzy()
 	t.WithNormalisation()
 	t.DefaultLevenshtein()
@@ -127,12 +226,16 @@ func New() *Trie {
 
 // WithFuzzy sets the Trie to use fuzzy matching on search.
 func (t *Trie) WithFuzzy() *Trie {
+	t.lock()
+	defer t.mu.Unlock()
 	t.fuzzy = true
 	return t
 }
 
 // WithoutFuzzy sets the Trie not to use fuzzy matching on search.
 func (t *Trie) WithoutFuzzy() *Trie {
+	t.lock()
+	defer t.mu.Unlock()
 	t.fuzzy = false
 	return t
 }
@@ -140,6 +243,8 @@ func (t *Trie) WithoutFuzzy() *Trie {
 // WithNormalisation sets the Trie to use normalisation on search.
 // For example, Jurg will find Jürgen, Jürg will find Jurgen.
 func (t *Trie) WithNormalisation() *Trie {
+	t.lock()
+	defer t.mu.Unlock()
 	t.normalised = true
 	return t
 }
@@ -147,18 +252,24 @@ func (t *Trie) WithNormalisation() *Trie {
 // WithoutNormalisation sets the Trie not to use normalisation on search.
 // for example Jurg won't find Jürgen, Jürg won't find Jurgen.
 func (t *Trie) WithoutNormalisation() *Trie {
+	t.lock()
+	defer t.mu.Unlock()
 	t.normalised = false
 	return t
 }
 
 // CaseSensitive sets the Trie to use case sensitive search.
 func (t *Trie) CaseSensitive() *Trie {
+	t.lock()
+	defer t.mu.Unlock()
 	t.caseSensitive = true
 	return t
 }
 
 // CaseInsensitive sets the Trie to use case insensitive search.
 func (t *Trie) CaseInsensitive() *Trie {
+	t.lock()
+	defer t.mu.Unlock()
 	t.caseSensitive = false
 	return t
 }
@@ -166,6 +277,8 @@ func (t *Trie) CaseInsensitive() *Trie {
 // WithoutLevenshtein sets the Trie not to allow any levenshtein distance between
 // between the search string and any matches.
 func (t *Trie) WithoutLevenshtein() *Trie {
+	t.lock()
+	defer t.mu.Unlock()
 	t.levenshteinScheme = map[uint8]uint8{0: 0}
 	t.levenshteinIntervals = []uint8{0}
 	return t
@@ -173,6 +286,8 @@ func (t *Trie) WithoutLevenshtein() *Trie {
 
 // DefaultLevenshtein sets the trie to use the default levenshtein scheme.
 func (t *Trie) DefaultLevenshtein() *Trie {
+	t.lock()
+	defer t.mu.Unlock()
 	t.levenshteinScheme = map[uint8]uint8{
 		shortStringThreshold:  shortStringLevenshteinLimit,
 		mediumStringThreshold: mediumStringLevenshteinLimit,
@@ -182,7 +297,8 @@ func (t *Trie) DefaultLevenshtein() *Trie {
 }
 
 // CustomLevenshtein sets up a custom levenshtein scheme.
-// WARNING, this function will panic if the scheme is invalid.
+// WARNING, this function will panic if the scheme is invalid. NewWithOptions with the
+// Levenshtein option returns an error instead.
 // A valid scheme is a series of pairs of search string length -> levenshtein distance.
 // There must be one entry with zero as search string length.
 func (t *Trie) CustomLevenshtein(scheme map[uint8]uint8) *Trie {
@@ -190,408 +306,484 @@ func (t *Trie) CustomLevenshtein(scheme map[uint8]uint8) *Trie {
 	if !ok {
 		panic("invalid levenshtein scheme for GAT")
 	}
-	t.levenshteinIntervals = make([]uint8, 0, len(scheme))
+	t.lock()
+	defer t.mu.Unlock()
+	t.setLevenshtein(scheme)
+	return t
+}
+
+// setLevenshtein installs a levenshtein scheme that is known to be valid.
+func (s *settings) setLevenshtein(scheme map[uint8]uint8) {
+	s.levenshteinIntervals = make([]uint8, 0, len(scheme))
 	for key := range scheme {
-		t.levenshteinIntervals = append(t.levenshteinIntervals, key)
+		s.levenshteinIntervals = append(s.levenshteinIntervals, key)
 	}
-	sort.Slice(t.levenshteinIntervals, func(i, j int) bool {
-		return t.levenshteinIntervals[i] > t.levenshteinIntervals[j]
+	sort.Slice(s.levenshteinIntervals, func(i, j int) bool {
+		return s.levenshteinIntervals[i] > s.levenshteinIntervals[j]
 	})
-	t.levenshteinScheme = scheme
-	return t
+	s.levenshteinScheme = scheme
 }
 
-// Insert inserts strings into the Trie
+var (
+	// ErrEmptyWord is the cause of an InsertError for a word that is empty once normalised.
+	ErrEmptyWord = errors.New("trie: empty word")
+	// ErrInvalidUTF8 is the cause of an InsertError for a word that is not valid UTF-8.
+	ErrInvalidUTF8 = errors.New("trie: invalid UTF-8")
+)
+
+// InsertError reports a word that could not be inserted and why.
+type InsertError struct {
+	Word string
+	Err  error
+}
+
+func (e *InsertError) Error() string {
+	return fmt.Sprintf("trie: cannot insert %q: %v", e.Word, e.Err)
+}
+
+func (e *InsertError) Unwrap() error { return e.Err }
+
+// Insert inserts strings into the Trie. Words that cannot be inserted, because they are empty
+// or not valid UTF-8, are skipped; TryInsert reports them.
 func (t *Trie) Insert(entries ...string) {
-	t.mu.Lock()
+	t.lock()
 	defer t.mu.Unlock()
 	for _, entry := range entries {
-		t.insertInternal(entry, nil)
+		t.insertInternal(entry, nil, 0)
 	}
 }
 
 // InsertWithMeta inserts a single string with associated metadata.
 func (t *Trie) InsertWithMeta(word string, meta interface{}) {
-	t.mu.Lock()
+	t.lock()
 	defer t.mu.Unlock()
-	t.insertInternal(word, meta)
+	t.insertInternal(word, meta, 0)
 }
 
 // BulkInsertWithMeta inserts multiple strings each with their own metadata.
 func (t *Trie) BulkInsertWithMeta(entries map[string]interface{}) {
-	t.mu.Lock()
+	t.lock()
 	defer t.mu.Unlock()
 	for k, v := range entries {
-		t.insertInternal(k, v)
+		t.insertInternal(k, v, 0)
+	}
+}
+
+// InsertWeighted inserts a single string with associated metadata and a ranking weight,
+// such as a popularity or click count. Among hits with the same levenshtein distance and
+// fuzzy flag, search results are ordered by descending weight before alphabetically.
+// Entries inserted through the other insert methods have a weight of zero. Words sharing a
+// key, such as "Apple" and "apple", share the highest weight they were inserted with.
+func (t *Trie) InsertWeighted(word string, meta interface{}, weight float64) {
+	t.lock()
+	defer t.mu.Unlock()
+	t.insertInternal(word, meta, weight)
+}
+
+// TryInsert is just like Insert, but reports the entries it could not insert. The error joins
+// an *InsertError for every such entry, and the other entries are inserted.
+func (t *Trie) TryInsert(entries ...string) error {
+	t.lock()
+	defer t.mu.Unlock()
+	var errs []error
+	for _, entry := range entries {
+		errs = append(errs, t.insertInternal(entry, nil, 0))
 	}
+	return errors.Join(errs...)
+}
+
+// TryInsertWithMeta is just like InsertWithMeta, but returns an *InsertError if the word
+// could not be inserted.
+func (t *Trie) TryInsertWithMeta(word string, meta interface{}) error {
+	t.lock()
+	defer t.mu.Unlock()
+	return t.insertInternal(word, meta, 0)
+}
+
+// TryBulkInsertWithMeta is just like BulkInsertWithMeta, but reports the entries it could not
+// insert. The error joins an *InsertError for every such entry, and the other entries are
+// inserted.
+func (t *Trie) TryBulkInsertWithMeta(entries map[string]interface{}) error {
+	t.lock()
+	defer t.mu.Unlock()
+	var errs []error
+	for k, v := range entries {
+		errs = append(errs, t.insertInternal(k, v, 0))
+	}
+	return errors.Join(errs...)
+}
+
+// TryInsertWeighted is just like InsertWeighted, but returns an *InsertError if the word
+// could not be inserted.
+func (t *Trie) TryInsertWeighted(word string, meta interface{}, weight float64) error {
+	t.lock()
+	defer t.mu.Unlock()
+	return t.insertInternal(word, meta, weight)
 }
 
 // insertInternal performs the actual insertion without locking.
-func (t *Trie) insertInternal(entry string, meta interface{}) {
-	transformer := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
-	if len(entry) == 0 {
-		return
+func (t *Trie) insertInternal(entry string, meta interface{}, weight float64) error {
+	if !utf8.ValidString(entry) {
+		return &InsertError{Word: entry, Err: ErrInvalidUTF8}
 	}
-	switch {
-	case t.normalised && t.caseSensitive:
-		normal, _, err := transform.String(transformer, entry)
-		if err != nil {
-			return
-		}
-		t.originalDict[normal] = append(t.originalDict[normal], entry)
-		entry = normal
-	case t.normalised && !t.caseSensitive:
-		normal, _, err := transform.String(transformer, entry)
-		if err != nil {
-			return
-		}
-		normal = strings.ToLower(normal)
-		t.originalDict[normal] = append(t.originalDict[normal], entry)
-		entry = normal
-	case !t.normalised && !t.caseSensitive:
-		lower := strings.ToLower(entry)
-		t.originalDict[lower] = append(t.originalDict[lower], entry)
-		entry = lower
+	key, err := t.key(entry)
+	if err != nil {
+		return &InsertError{Word: entry, Err: err}
 	}
+	if len(key) == 0 {
+		return &InsertError{Word: entry, Err: ErrEmptyWord}
+	}
+	t.root = t.own(t.root)
 	currentNode := t.root
-	for index, character := range entry {
+	if weight > currentNode.maxWeight {
+		currentNode.maxWeight = weight
+	}
+	for _, character := range key {
 		child, ok := currentNode.children[character]
 		if !ok {
-			child = new(node)
-			child.children = make(map[rune]*node)
-			if index == len(entry)-len(string(character)) {
-				child.word = entry
-				child.meta = meta
-			}
+			child = &node{children: make(map[rune]*node), maxWeight: weight, gen: t.gen}
 			currentNode.children[character] = child
+		} else if owned := t.own(child); owned != child {
+			child = owned
+			currentNode.children[character] = child
+		}
+		if weight > child.maxWeight {
+			child.maxWeight = weight
 		}
 		currentNode = child
 	}
-	if currentNode.word == entry {
-		currentNode.meta = meta
-	}
-}
-
-// Delete removes a word and its metadata from the trie.
-func (t *Trie) Delete(word string) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	transformer := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
-	switch {
-	case t.normalised && t.caseSensitive:
-		normal, _, err := transform.String(transformer, word)
-		if err == nil {
-			word = normal
-		}
-	case t.normalised && !t.caseSensitive:
-		normal, _, err := transform.String(transformer, word)
-		if err == nil {
-			word = strings.ToLower(normal)
+	// the key keeps the highest weight of its original forms, and a form inserted again
+	// replaces its own weight only
+	for _, v := range currentNode.variants {
+		if v.word != entry {
+			weight = max(weight, currentNode.weight)
+			break
 		}
-	case !t.normalised && !t.caseSensitive:
-		word = strings.ToLower(word)
 	}
+	if t.keepsOriginals() {
+		currentNode.addVariant(entry, meta)
+	}
+	entry = key
+	previous, indexed := currentNode.weight, currentNode.word != ""
+	lowered := indexed && previous > weight
+	currentNode.word = entry
+	currentNode.meta = meta
+	currentNode.weight = weight
+	if lowered {
+		refreshMaxWeights(t.path(entry))
+	}
+	if t.wordStarts {
+		t.indexWordStarts(key, currentNode, indexed, previous)
+	}
+	return nil
+}
 
-	// remove from original dictionary
-	delete(t.originalDict, word)
-
-	// traverse to node
-	runes := []rune(word)
-	path := make([]*node, 0, len(runes)+1)
-	path = append(path, t.root)
+// path returns the nodes from the root to the node of the normalised word, or as far as they exist.
+func (t *Trie) path(word string) []*node {
+	path := []*node{t.root}
 	current := t.root
-	for _, r := range runes {
+	for _, r := range word {
 		next, ok := current.children[r]
 		if !ok {
-			return
+			break
 		}
 		current = next
 		path = append(path, current)
 	}
-	current.word = ""
-	current.meta = nil
-	// prune
-	for i := len(runes); i > 0; i-- {
-		parent := path[i-1]
-		child := path[i]
-		if len(child.children) == 0 && child.word == "" {
-			delete(parent.children, runes[i-1])
-		} else {
-			break
-		}
-	}
+	return path
 }
 
-// FindMeta returns the metadata stored for the exact word, if present.
-func (t *Trie) FindMeta(word string) (interface{}, bool) {
-	transformer := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
-	switch {
-	case t.normalised && t.caseSensitive:
-		normal, _, err := transform.String(transformer, word)
-		if err == nil {
-			word = normal
+// refreshMaxWeights recomputes maxWeight and maxSelections for the nodes of a path from the
+// root, deepest first, after a weight or selections on the path were lowered or removed.
+func refreshMaxWeights(path []*node) {
+	for i := len(path) - 1; i >= 0; i-- {
+		n := path[i]
+		maxWeight, found := n.weight, n.word != ""
+		maxSelections := n.selections
+		for _, child := range n.children {
+			if !found || child.maxWeight > maxWeight {
+				maxWeight, found = child.maxWeight, true
+			}
+			maxSelections = max(maxSelections, child.maxSelections)
 		}
-	case t.normalised && !t.caseSensitive:
-		normal, _, err := transform.String(transformer, word)
-		if err == nil {
-			word = strings.ToLower(normal)
+		if !found {
+			maxWeight = 0
 		}
-	case !t.normalised && !t.caseSensitive:
-		word = strings.ToLower(word)
-	}
-	current := t.root
-	for _, r := range word {
-		next, ok := current.children[r]
-		if !ok {
-			return nil, false
+		if maxWeight == n.maxWeight && maxSelections == n.maxSelections {
+			return
 		}
-		current = next
+		n.maxWeight, n.maxSelections = maxWeight, maxSelections
 	}
-	if current.word == word {
-		return current.meta, true
-	}
-	return nil, false
 }
 
-// SearchAll is just like Search, but without a limit.
-func (t *Trie) SearchAll(search string) []string {
-	return t.Search(search, 0)
+// entry is a word as it was inserted, with its metadata.
+type entry struct {
+	word string
+	meta interface{}
 }
 
-// SearchAllMeta performs a fuzzy search returning words with their metadata.
-func (t *Trie) SearchAllMeta(search string) []Match {
-	if len(search) == 0 {
-		return []Match{}
-	}
-	if t.normalised {
-		transformer := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
-		var err error
-		search, _, err = transform.String(transformer, search)
-		if err != nil {
-			return []Match{}
-		}
-	}
-	if !t.caseSensitive {
-		search = strings.ToLower(search)
-	}
-	maxDistance := t.maxDistance(search)
-	collection := make(map[string]matchScore)
-	t.collectMeta(collection, search, t.root, 0, maxDistance, 0, t.fuzzy, false)
-	hits := make([]Match, 0, len(collection))
-	for word, sc := range collection {
-		hits = append(hits, Match{Word: word, Meta: sc.meta})
-	}
-	sort.Slice(hits, func(i, j int) bool {
-		switch {
-		case collection[hits[i].Word].levenshtein != collection[hits[j].Word].levenshtein:
-			return collection[hits[i].Word].levenshtein < collection[hits[j].Word].levenshtein
-		case collection[hits[i].Word].fuzzy && !collection[hits[j].Word].fuzzy:
-			return false
-		case !collection[hits[i].Word].fuzzy && collection[hits[j].Word].fuzzy:
-			return true
-		default:
-			return hits[i].Word < hits[j].Word
-		}
-	})
-	if !t.normalised && t.caseSensitive {
-		return hits
-	}
-	results := make([]Match, 0, len(hits)*2)
-	for _, hit := range hits {
-		originals := t.originalDict[hit.Word]
-		if len(originals) == 0 {
-			results = append(results, hit)
-			continue
-		}
-		for _, orig := range originals {
-			results = append(results, Match{Word: orig, Meta: hit.Meta})
+// addVariant records word as an original form of the word of n with its metadata, replacing
+// the metadata of an earlier insert of the same word.
+func (n *node) addVariant(word string, meta interface{}) {
+	for i := range n.variants {
+		if n.variants[i].word == word {
+			n.variants[i].meta = meta
+			return
 		}
 	}
-	return results
+	n.variants = append(n.variants, entry{word, meta})
 }
 
-// Search will return all complete words in the trie that have the search string as a prefix,
-// taking into account the Trie's settings for normalisation, fuzzy matching and levenshtein distance scheme.
-func (t *Trie) Search(search string, limit int) []string {
-	if len(search) == 0 {
-		return []string{}
-	}
-	if t.normalised {
-		transformer := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
-		var err error
-		search, _, err = transform.String(transformer, search)
-		if err != nil {
-			return []string{}
-		}
-	}
-	if !t.caseSensitive {
-		search = strings.ToLower(search)
-	}
-	maxDistance := t.maxDistance(search)
-	// start the recursive function
-	collection := make(map[string]score)
-	t.collect(collection, search, t.root, 0, maxDistance, limit, t.fuzzy, false)
-	hits := make([]string, 0, len(collection))
-	for key := range collection {
-		hits = append(hits, key)
-	}
-	sort.Slice(hits, func(i, j int) bool {
-		switch {
-		case collection[hits[i]].levenshtein != collection[hits[j]].levenshtein:
-			return collection[hits[i]].levenshtein < collection[hits[j]].levenshtein
-		case collection[hits[i]].fuzzy && !collection[hits[j]].fuzzy:
-			return false
-		case !collection[hits[i]].fuzzy && collection[hits[j]].fuzzy:
-			return true
-		default:
-			return hits[i] < hits[j]
-		}
-	})
-	if len(hits) >= limit && limit != 0 {
-		return hits[:limit]
+// own returns n if the trie may change it in place, or else a copy of n that it may change.
+// The copy shares its children with n, so the caller has to link it into an owned parent.
+func (t *Trie) own(n *node) *node {
+	if n.gen == t.gen {
+		return n
 	}
-	if !t.normalised && t.caseSensitive {
-		return hits
+	owned := *n
+	owned.children = maps.Clone(n.children)
+	owned.variants = slices.Clone(n.variants)
+	if n.start != nil {
+		owned.start = &wordStart{targets: maps.Clone(n.start.targets), top: n.start.top}
 	}
-	originals := make([]string, 0, len(hits)*2)
-	for _, hit := range hits {
-		originals = append(originals, t.originalDict[hit]...)
+	owned.gen = t.gen
+	return &owned
+}
+
+// snapshot returns a published trie with the words of t, which keeps them while t changes.
+// The nodes of t are marked as shared, so the next change of t leaves them to an older
+// generation and copies them before changing them.
+func (t *Trie) snapshot() *Trie {
+	if t.published {
+		return t
+	}
+	t.rlock()
+	defer t.runlock()
+	t.shared.Store(true)
+	return &Trie{
+		root:      t.root,
+		starts:    t.starts,
+		settings:  t.settings,
+		gen:       t.gen,
+		published: true,
+		metaCodec: t.metaCodec,
 	}
-	return originals
 }
 
-// collect is a recursive function that traverses the Trie and inserts words from Word-final nodes which match the search
-// text in the map collection. It handles substitution, insertion and deletion to the levenshtein distance limit and also
-// allows fuzzy search.
-func (t *Trie) collect(collection map[string]score, word string, node *node, distance, maxDistance uint8, limit int, fuzzyAllowed, fuzzyUsed bool) {
-	if len(word) == 0 {
-		if node.word != "" {
-			previousScore, ok := collection[node.word]
-			if !ok || distance < previousScore.levenshtein ||
-				(distance == previousScore.levenshtein && previousScore.fuzzy && !fuzzyUsed) {
-				collection[node.word] = score{levenshtein: distance, fuzzy: fuzzyUsed}
-			}
-			node.collectAllDescendentWords(collection, distance, fuzzyUsed)
-			return
-		}
-		node.collectAllDescendentWords(collection, distance, fuzzyUsed)
+// lock takes the write lock. It panics if the trie is a published snapshot, which other
+// goroutines read without locking. If a snapshot shares the nodes of the trie, the changes
+// made under the lock go to a new generation.
+func (t *Trie) lock() {
+	if t.published {
+		panic("trie: published snapshots are read-only")
 	}
-	character, size := utf8.DecodeRuneInString(word)
-	subword := word[size:]
-	// special rune for string collisions
-	if character == '*' {
-		t.collect(collection, subword, node, distance, maxDistance, limit, false, fuzzyUsed)
+	t.mu.Lock()
+	if t.shared.Swap(false) {
+		t.gen++
 	}
+}
 
-	if next := node.children[character]; next != nil {
-		t.collect(collection, subword, next, distance, maxDistance, limit, false, fuzzyUsed)
+// rlock takes the read lock, unless the trie is a published snapshot that never changes.
+func (t *Trie) rlock() {
+	if !t.published {
+		t.mu.RLock()
 	}
+}
 
-	if distance < maxDistance {
-		distance++
-
-		for character, next := range node.children {
-			// Substition
-			t.collect(collection, string(character)+subword, node, distance, maxDistance, limit, false, fuzzyUsed)
-			// Insertion
-			t.collect(collection, string(character)+word, node, distance, maxDistance, limit, false, fuzzyUsed)
-			// Fuzzy
-			if fuzzyAllowed {
-				t.collect(collection, word, next, distance-1, maxDistance, limit, true, true)
-			}
-		}
-		// Deletion
-		t.collect(collection, subword, node, distance, maxDistance, limit, false, false)
-	} else if distance == 0 {
-		for _, next := range node.children {
-			// Fuzzy without levenshtein
-			if fuzzyAllowed {
-				t.collect(collection, word, next, distance, maxDistance, limit, true, true)
-			}
-		}
+func (t *Trie) runlock() {
+	if !t.published {
+		t.mu.RUnlock()
 	}
 }
 
-func (t *Trie) collectMeta(collection map[string]matchScore, word string, node *node, distance, maxDistance uint8, limit int, fuzzyAllowed, fuzzyUsed bool) {
-	if len(word) == 0 {
-		if node.word != "" {
-			previousScore, ok := collection[node.word]
-			if !ok || distance < previousScore.levenshtein ||
-				(distance == previousScore.levenshtein && previousScore.fuzzy && !fuzzyUsed) {
-				collection[node.word] = matchScore{score{levenshtein: distance, fuzzy: fuzzyUsed}, node.meta}
-			}
-			node.collectAllDescendentWordsMeta(collection, distance, fuzzyUsed)
-			return
-		}
-		node.collectAllDescendentWordsMeta(collection, distance, fuzzyUsed)
+// Delete removes the word, exactly as it was inserted, and its metadata from the trie. Words
+// that only differ from it in case or accents stay in the trie. It reports whether the word
+// was found.
+func (t *Trie) Delete(word string) bool {
+	t.lock()
+	defer t.mu.Unlock()
+	return t.deleteInternal(word, false)
+}
+
+// DeleteAll removes the word together with every word that only differs from it in case or
+// accents, and their metadata, from the trie. It reports whether any word was found.
+func (t *Trie) DeleteAll(word string) bool {
+	t.lock()
+	defer t.mu.Unlock()
+	return t.deleteInternal(word, true)
+}
+
+// deleteInternal performs the actual deletion without locking, of the exact word or of all
+// the words sharing its key.
+func (t *Trie) deleteInternal(word string, all bool) bool {
+	key, err := t.key(word)
+	if err != nil {
+		return false
 	}
-	character, size := utf8.DecodeRuneInString(word)
-	subword := word[size:]
-	if character == '*' {
-		t.collectMeta(collection, subword, node, distance, maxDistance, limit, false, fuzzyUsed)
+	n, ok := findIndex[*node](trieIndex{t}, key)
+	if !ok {
+		return false
 	}
-
-	if next := node.children[character]; next != nil {
-		t.collectMeta(collection, subword, next, distance, maxDistance, limit, false, fuzzyUsed)
+	variant := slices.IndexFunc(n.variants, func(v entry) bool { return v.word == word })
+	if !all && len(n.variants) > 0 && variant < 0 {
+		return false
+	}
+	var starts []string
+	if t.wordStarts {
+		starts = t.startKeys(key, originals(n))
 	}
 
-	if distance < maxDistance {
-		distance++
-
-		for character, next := range node.children {
-			t.collectMeta(collection, string(character)+subword, node, distance, maxDistance, limit, false, fuzzyUsed)
-			t.collectMeta(collection, string(character)+word, node, distance, maxDistance, limit, false, fuzzyUsed)
-			if fuzzyAllowed {
-				t.collectMeta(collection, word, next, distance-1, maxDistance, limit, true, true)
-			}
-		}
-		t.collectMeta(collection, subword, node, distance, maxDistance, limit, false, false)
-	} else if distance == 0 {
-		for _, next := range node.children {
-			if fuzzyAllowed {
-				t.collectMeta(collection, word, next, distance, maxDistance, limit, true, true)
-			}
+	// traverse to node, copying the nodes shared with a snapshot
+	runes := []rune(key)
+	path := make([]*node, 0, len(runes)+1)
+	t.root = t.own(t.root)
+	path = append(path, t.root)
+	current := t.root
+	for _, r := range runes {
+		next := t.own(current.children[r])
+		current.children[r] = next
+		current = next
+		path = append(path, current)
+	}
+	if !all && len(current.variants) > 1 {
+		current.variants = slices.Delete(current.variants, variant, variant+1)
+		current.meta = current.variants[len(current.variants)-1].meta
+		if t.wordStarts {
+			kept := t.startKeys(key, originals(current))
+			t.unindexWordStarts(key, current.weight, slices.DeleteFunc(starts, func(start string) bool {
+				return slices.Contains(kept, start)
+			}))
 		}
+		return true
 	}
+	weight := current.weight
+	current.word = ""
+	current.variants = nil
+	current.meta = nil
+	current.weight = 0
+	current.selections, current.selectedAt = 0, 0
+	refreshMaxWeights(prune(path, runes))
+	t.unindexWordStarts(key, weight, starts)
+	return true
 }
 
-// collectAllDescendentWords returns the words from all nodes that are descedent of the current node.
-func (n *node) collectAllDescendentWords(collection map[string]score, distance uint8, fuzzyUsed bool) {
-	for _, node := range n.children {
-		if node.word != "" {
-			previousScore, ok := collection[node.word]
-
-			if !ok || distance < previousScore.levenshtein ||
-				(distance == previousScore.levenshtein && previousScore.fuzzy && !fuzzyUsed) {
-				collection[node.word] = score{levenshtein: distance, fuzzy: fuzzyUsed}
-			}
+// prune removes the nodes at the end of path that neither end a word nor have children, and
+// returns the rest of path. runes are the runes leading to the nodes of path after the first.
+func prune(path []*node, runes []rune) []*node {
+	for i := len(runes); i > 0; i-- {
+		if len(path[i].children) > 0 || path[i].word != "" {
+			break
 		}
-		node.collectAllDescendentWords(collection, distance, fuzzyUsed)
+		delete(path[i-1].children, runes[i-1])
+		path = path[:i]
 	}
+	return path
 }
 
-func (n *node) collectAllDescendentWordsMeta(collection map[string]matchScore, distance uint8, fuzzyUsed bool) {
-	for _, node := range n.children {
-		if node.word != "" {
-			previousScore, ok := collection[node.word]
-			if !ok || distance < previousScore.levenshtein ||
-				(distance == previousScore.levenshtein && previousScore.fuzzy && !fuzzyUsed) {
-				collection[node.word] = matchScore{score{levenshtein: distance, fuzzy: fuzzyUsed}, node.meta}
-			}
-		}
-		node.collectAllDescendentWordsMeta(collection, distance, fuzzyUsed)
-	}
+// FindMeta returns the metadata stored for the exact word, if present. Of the words that only
+// differ from it in case or accents, it prefers the one inserted exactly as word, and else the
+// one inserted last.
+func (t *Trie) FindMeta(word string) (interface{}, bool) {
+	t.rlock()
+	defer t.runlock()
+	return findMeta[*node](trieIndex{t}, &t.settings, word)
+}
+
+// SearchAll is just like Search, but without a limit.
+func (t *Trie) SearchAll(search string, opts ...Option) []string {
+	return t.Search(search, 0, opts...)
+}
+
+// SearchAllMeta performs a fuzzy search returning words with their metadata.
+func (t *Trie) SearchAllMeta(search string, opts ...Option) []Match {
+	return t.SearchMeta(search, 0, opts...)
+}
+
+// Search will return all complete words in the trie that have the search string as a prefix,
+// taking into account the Trie's settings for normalisation, fuzzy matching and levenshtein distance scheme.
+// A positive limit returns only the best limit words. The search then skips every branch of the trie
+// that cannot improve on the words found so far, so its cost depends on the limit rather than on
+// the number of words sharing the prefix.
+// Options override the Trie's settings for this search only. An invalid option returns no words,
+// SearchContext reports it as an error.
+func (t *Trie) Search(search string, limit int, opts ...Option) []string {
+	matches := t.SearchMeta(search, limit, opts...)
+	words := make([]string, len(matches))
+	for i, match := range matches {
+		words[i] = match.Word
+	}
+	return words
+}
+
+// SearchMeta is just like Search, but returns the words with their metadata.
+func (t *Trie) SearchMeta(search string, limit int, opts ...Option) []Match {
+	t.rlock()
+	defer t.runlock()
+	matches, _ := searchIndex[*node](context.Background(), trieIndex{t}, &t.settings, search, limit, opts...)
+	return matches
+}
+
+// SearchContext is just like SearchMeta, but gives up when ctx is done. It then returns the
+// matches found so far, which may be missing better ones, together with the context's error.
+func (t *Trie) SearchContext(ctx context.Context, search string, limit int, opts ...Option) ([]Match, error) {
+	t.rlock()
+	defer t.runlock()
+	return searchIndex[*node](ctx, trieIndex{t}, &t.settings, search, limit, opts...)
 }
 
 // maxDistance determines the maximum levenshein distance based on the levenshtein scheme
 // and search string length.
-func (t *Trie) maxDistance(search string) (maxDistance uint8) {
+func (s *settings) maxDistance(search string) (maxDistance uint8) {
 	runes := []rune(search)
-	for _, limit := range t.levenshteinIntervals {
+	for _, limit := range s.levenshteinIntervals {
 		if len(runes) >= int(limit) {
-			maxDistance = t.levenshteinScheme[limit]
+			maxDistance = s.levenshteinScheme[limit]
 			return
 		}
 	}
 	return
 }
+
+// trieIndex implements index over the nodes of a Trie.
+type trieIndex struct{ t *Trie }
+
+func (ti trieIndex) root() *node { return ti.t.root }
+
+func (trieIndex) child(n *node, r rune) (*node, bool) {
+	next, ok := n.children[r]
+	return next, ok
+}
+
+func (trieIndex) appendChildren(edges []edge[*node], n *node, sorted bool) []edge[*node] {
+	start := len(edges)
+	for character, child := range n.children {
+		edges = append(edges, edge[*node]{character, child})
+	}
+	if sorted {
+		slices.SortFunc(edges[start:], func(a, b edge[*node]) int { return int(a.r - b.r) })
+	}
+	return edges
+}
+
+func (trieIndex) terminal(n *node) bool { return n.word != "" }
+
+func (trieIndex) word(n *node) string { return n.word }
+
+func (trieIndex) weight(n *node) float64 { return n.weight }
+
+func (trieIndex) maxWeight(n *node) float64 { return n.maxWeight }
+
+func (trieIndex) selections(n *node) (float64, int64) { return n.selections, n.selectedAt }
+
+func (trieIndex) maxSelections(n *node) float64 { return n.maxSelections }
+
+func (trieIndex) variants(n *node) []entry { return n.variants }
+
+func (trieIndex) meta(n *node) interface{} { return n.meta }
+
+func (ti trieIndex) starts() (index[*node], bool) {
+	if !ti.t.wordStarts || ti.t.starts == nil {
+		return nil, false
+	}
+	return startsIndex{ti}, true
+}
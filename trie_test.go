@@ -1,6 +1,11 @@
 package trie
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -133,6 +138,302 @@ func TestCollect(t *testing.T) {
 	}
 }
 
+func TestWeightedRanking(t *testing.T) {
+	t.Run("Weight orders equal distance hits", func(t *testing.T) {
+		tr := New()
+		tr.InsertWeighted("apple", nil, 1)
+		tr.InsertWeighted("apricot", nil, 10)
+		tr.Insert("april")
+		assert.Equal(t, []string{"apricot", "apple", "april"}, tr.SearchAll("ap"))
+	})
+
+	t.Run("Distance outranks weight", func(t *testing.T) {
+		tr := New()
+		tr.InsertWeighted("hallo", nil, 100)
+		tr.Insert("hello")
+		assert.Equal(t, []string{"hello", "hallo"}, tr.SearchAll("hello"))
+	})
+
+	t.Run("SearchAllMeta uses weights", func(t *testing.T) {
+		tr := New()
+		tr.InsertWeighted("iPad", "tablet", 1)
+		tr.InsertWeighted("iPhone", "phone", 5)
+		hits := tr.SearchAllMeta("ip")
+		assert.Equal(t, 2, len(hits))
+		assert.Equal(t, "iPhone", hits[0].Word)
+		assert.Equal(t, "phone", hits[0].Meta)
+	})
+
+	t.Run("Reinsert resets weight", func(t *testing.T) {
+		tr := New()
+		tr.InsertWeighted("beta", nil, 10)
+		tr.Insert("bravo")
+		assert.Equal(t, []string{"beta", "bravo"}, tr.SearchAll("b"))
+		tr.InsertWeighted("bravo", nil, 20)
+		assert.Equal(t, []string{"bravo", "beta"}, tr.SearchAll("b"))
+		tr.Insert("bravo")
+		assert.Equal(t, []string{"beta", "bravo"}, tr.SearchAll("b"))
+	})
+
+	t.Run("Forms of a key share the highest weight", func(t *testing.T) {
+		tr := New()
+		tr.InsertWeighted("Apple", nil, 10)
+		tr.InsertWeighted("apricot", nil, 5)
+		tr.Insert("apple")
+		assert.Equal(t, []string{"apple", "Apple", "apricot"}, tr.SearchAll("ap"))
+		tr.Delete("apple")
+		assert.Equal(t, []string{"Apple", "apricot"}, tr.SearchAll("ap"))
+	})
+
+	t.Run("Prefix of existing word", func(t *testing.T) {
+		tr := New()
+		tr.InsertWeighted("hello", nil, 1)
+		tr.InsertWeighted("hell", nil, 2)
+		assert.Equal(t, []string{"hell", "hello"}, tr.SearchAll("hel"))
+	})
+}
+
+func TestDefaultRanking(t *testing.T) {
+	t.Run("Exact matches first", func(t *testing.T) {
+		tr := New()
+		tr.InsertWeighted("apple pie", nil, 5)
+		tr.Insert("Apple", "applesauce")
+		assert.Equal(t, []string{"Apple", "apple pie", "applesauce"}, tr.SearchAll("apple"))
+		assert.Equal(t, []string{"Apple"}, tr.Search("apple", 1))
+	})
+
+	t.Run("Originals typed like the search first", func(t *testing.T) {
+		tr := New().WithoutLevenshtein()
+		tr.Insert("apple", "Apple", "Äpfel", "apfel")
+		assert.Equal(t, []string{"Apple", "apple"}, tr.SearchAll("Apple"))
+		assert.Equal(t, []string{"apple", "Apple"}, tr.SearchAll("apple"))
+		assert.Equal(t, []string{"Äpfel", "apfel"}, tr.SearchAll("Äpf"))
+		assert.Equal(t, []string{"Äpfel"}, tr.Search("Äp", 1))
+	})
+
+	t.Run("Shorter completions first", func(t *testing.T) {
+		tr := New()
+		tr.Insert("banana split", "bandana", "band")
+		assert.Equal(t, []string{"band", "bandana", "banana split"}, tr.SearchAll("ban"))
+		assert.Equal(t, []string{"band", "bandana"}, tr.Search("ban", 2))
+	})
+}
+
+func TestSearchLimit(t *testing.T) {
+	t.Run("Returns originals", func(t *testing.T) {
+		tr := New()
+		tr.Insert("Hello", "Help", "Helmet")
+		assert.Equal(t, []string{"Help", "Hello"}, tr.Search("hel", 2))
+	})
+
+	t.Run("Matches unlimited search", func(t *testing.T) {
+		rnd := rand.New(rand.NewSource(1))
+		letters := []rune("abcdeéA")
+		tr := New()
+		for i := 0; i < 1000; i++ {
+			word := make([]rune, 1+rnd.Intn(7))
+			for j := range word {
+				word[j] = letters[rnd.Intn(len(letters))]
+			}
+			tr.InsertWeighted(string(word), nil, float64(rnd.Intn(4)))
+		}
+		for i := 0; i < 100; i++ {
+			query := make([]rune, 1+rnd.Intn(6))
+			for j := range query {
+				query[j] = letters[rnd.Intn(len(letters))]
+			}
+			all := tr.SearchAll(string(query))
+			for _, limit := range []int{1, 3, 10} {
+				expected := all
+				if len(expected) > limit {
+					expected = expected[:limit]
+				}
+				assert.Equal(t, expected, tr.Search(string(query), limit), "%s limit %d", string(query), limit)
+			}
+		}
+	})
+
+	t.Run("Skips fuzzy matches that cannot rank", func(t *testing.T) {
+		rnd := rand.New(rand.NewSource(2))
+		tr := New()
+		for i := 0; i < 20000; i++ {
+			word := make([]rune, 4+rnd.Intn(6))
+			for j := range word {
+				word[j] = 'a' + rune(rnd.Intn(26))
+			}
+			tr.Insert(string(word))
+		}
+		visits := func(limit int) int {
+			idx := countingIndex{trieIndex: trieIndex{tr}}
+			idx.visited = new(int)
+			_, err := searchIndex[*node](context.Background(), idx, &tr.settings, "ab", limit)
+			assert.NoError(t, err)
+			return *idx.visited
+		}
+		limited, all := visits(5), visits(0)
+		assert.Less(t, limited*100, all)
+	})
+}
+
+// countingIndex counts the nodes whose children a search visits.
+type countingIndex struct {
+	trieIndex
+	visited *int
+}
+
+func (c countingIndex) appendChildren(edges []edge[*node], n *node, sorted bool) []edge[*node] {
+	*c.visited++
+	return c.trieIndex.appendChildren(edges, n, sorted)
+}
+
+// stoppingContext reports itself cancelled after its Err method has been called a number of times.
+type stoppingContext struct {
+	context.Context
+	calls int
+}
+
+func (c *stoppingContext) Done() <-chan struct{} { return make(chan struct{}) }
+
+func (c *stoppingContext) Err() error {
+	if c.calls--; c.calls < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestSearchContext(t *testing.T) {
+	tr := New()
+	for i := 0; i < 5000; i++ {
+		tr.Insert(fmt.Sprintf("w%05d", i))
+	}
+
+	t.Run("Complete", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		matches, err := tr.SearchContext(ctx, "w0", 3)
+		assert.NoError(t, err)
+		assert.Equal(t, tr.SearchMeta("w0", 3), matches)
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := tr.SearchContext(ctx, "w0", 0)
+		assert.Equal(t, context.Canceled, err)
+	})
+
+	t.Run("Partial results", func(t *testing.T) {
+		matches, err := tr.SearchContext(&stoppingContext{Context: context.Background(), calls: 2}, "w0", 0)
+		assert.Equal(t, context.Canceled, err)
+		assert.NotEmpty(t, matches)
+		assert.Less(t, len(matches), len(tr.SearchAll("w0")))
+	})
+}
+
+func TestTryInsert(t *testing.T) {
+	t.Run("Reports bad entries", func(t *testing.T) {
+		tr := New()
+		err := tr.TryInsert("hello", "", "\xffhelp", "\u0301", "help")
+		var insertErr *InsertError
+		assert.True(t, errors.As(err, &insertErr))
+		assert.Equal(t, "", insertErr.Word)
+		assert.True(t, errors.Is(err, ErrEmptyWord))
+		assert.True(t, errors.Is(err, ErrInvalidUTF8))
+		assert.Equal(t, 3, len(err.(interface{ Unwrap() []error }).Unwrap()))
+		assert.Equal(t, []string{"help", "hello"}, tr.SearchAll("hel"))
+	})
+
+	t.Run("Single entries", func(t *testing.T) {
+		tr := New()
+		assert.NoError(t, tr.TryInsertWithMeta("hello", 1))
+		assert.NoError(t, tr.TryInsertWeighted("help", 2, 3))
+		assert.NoError(t, tr.TryBulkInsertWithMeta(map[string]interface{}{"helium": 4}))
+		assert.Equal(t, []string{"help", "hello", "helium"}, tr.SearchAll("hel"))
+
+		err := tr.TryInsertWithMeta("\xff", 1)
+		assert.True(t, errors.Is(err, ErrInvalidUTF8))
+		assert.EqualError(t, err, `trie: cannot insert "\xff": trie: invalid UTF-8`)
+		assert.True(t, errors.Is(tr.TryInsertWeighted("", nil, 1), ErrEmptyWord))
+		assert.True(t, errors.Is(tr.TryBulkInsertWithMeta(map[string]interface{}{"": 1, "ok": 2}), ErrEmptyWord))
+		_, ok := tr.FindMeta("ok")
+		assert.True(t, ok)
+	})
+}
+
+func TestConcurrency(t *testing.T) {
+	t.Run("Insert, delete and search", func(t *testing.T) {
+		tr := New()
+		tr.Insert("hello", "help", "world")
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(2)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					word := fmt.Sprintf("hel%d-%d", g, i)
+					tr.InsertWeighted(word, i, float64(i%5))
+					if i%3 == 0 {
+						tr.Delete(word)
+					}
+				}
+			}(g)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					// the words inserted at the start are never deleted
+					assert.Subset(t, tr.SearchAll("hel"), []string{"hello", "help"})
+					assert.Contains(t, []int{2, 3}, len(tr.Search("hel", 3)))
+					_, ok := tr.FindMeta("world")
+					assert.True(t, ok)
+				}
+			}()
+		}
+		wg.Wait()
+		for g := 0; g < 4; g++ {
+			for i := 0; i < 200; i++ {
+				meta, ok := tr.FindMeta(fmt.Sprintf("hel%d-%d", g, i))
+				assert.Equal(t, i%3 != 0, ok)
+				if ok {
+					assert.Equal(t, i, meta)
+				}
+			}
+		}
+	})
+
+	t.Run("Settings, snapshots and search", func(t *testing.T) {
+		tr := New()
+		tr.Insert("Hello", "Jürgen")
+		var wg sync.WaitGroup
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				tr.WithoutFuzzy().CaseSensitive().CustomLevenshtein(map[uint8]uint8{0: 1})
+				tr.WithFuzzy().CaseInsensitive().DefaultLevenshtein()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				tr.SearchAllMeta("jur")
+				_, err := tr.SearchContext(context.Background(), "hel", 1, Fuzzy(false))
+				assert.NoError(t, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				_, err := tr.MarshalBinary()
+				assert.NoError(t, err)
+				_, err = tr.Freeze()
+				assert.NoError(t, err)
+			}
+		}()
+		wg.Wait()
+		assert.Equal(t, []string{"Hello"}, tr.SearchAll("hel"))
+	})
+}
+
 func BenchmarkInsert(b *testing.B) {
 	t := New()
 	b.ReportAllocs()
@@ -166,6 +467,39 @@ func BenchmarkSearch(b *testing.B) {
 	result = r
 }
 
+func BenchmarkSearchLimit(b *testing.B) {
+	t := New()
+	for i := 0; i < 100000; i++ {
+		t.Insert(fmt.Sprintf("h%x", i))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	var r []string
+	for n := 0; n < b.N; n++ {
+		r = t.Search("h", 10)
+	}
+	result = r
+}
+
+func BenchmarkSearchLimitTypos(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	t := New()
+	for i := 0; i < 200000; i++ {
+		word := make([]rune, 4+rnd.Intn(8))
+		for j := range word {
+			word[j] = 'a' + rune(rnd.Intn(26))
+		}
+		t.Insert(string(word))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	var r []string
+	for n := 0; n < b.N; n++ {
+		r = t.Search("abcde", 10)
+	}
+	result = r
+}
+
 func BenchmarkSearchAll(b *testing.B) {
 	t := New()
 	t.Insert("hallo you")
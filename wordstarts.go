@@ -0,0 +1,234 @@
+package trie
+
+import (
+	"math"
+	"slices"
+)
+
+// WordStarts turns matching at the start of every word of an entry on or off, off by default.
+// With it, a search for "york" finds "New York" and one for "pro" finds "MacBook Pro", as the
+// later words of every entry are indexed as well, separated by whitespace and punctuation.
+// Such matches are reported with MidEntry and rank after all the matches at the start of an
+// entry, and every entry is listed only once. It is set for a whole trie with NewWithOptions
+// or Reconfigure, and a single search can only turn it off.
+func WordStarts(enabled bool) Option {
+	return func(s *settings) error {
+		s.wordStarts = enabled
+		return nil
+	}
+}
+
+// startKeys returns the keys of the later words of words, the original forms of the entry
+// with key, leaving out key itself and the words that have no key.
+func (s *settings) startKeys(key string, words []string) []string {
+	var keys []string
+	for _, word := range words {
+		spans := wordSpans(word)
+		for i := 1; i < len(spans); i++ {
+			start, err := s.key(word[spans[i].Start:])
+			if err == nil && start != "" && start != key && !slices.Contains(keys, start) {
+				keys = append(keys, start)
+			}
+		}
+	}
+	return keys
+}
+
+// wordSpans returns the spans of the words of word, which are separated by whitespace and
+// punctuation.
+func wordSpans(word string) []Span {
+	var spans []Span
+	start := -1
+	for i, r := range word {
+		switch {
+		case isSeparator(r) && start >= 0:
+			spans = append(spans, Span{start, i})
+			start = -1
+		case !isSeparator(r) && start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, Span{start, len(word)})
+	}
+	return spans
+}
+
+// originals returns the words that were inserted with the word of n as their key.
+func originals(n *node) []string {
+	if len(n.variants) == 0 {
+		return []string{n.word}
+	}
+	words := make([]string, len(n.variants))
+	for i, v := range n.variants {
+		words[i] = v.word
+	}
+	return words
+}
+
+// wordStart holds the entries of a word start node, which are its variants.
+type wordStart struct {
+	// targets holds the index in the variants of the node of the key of every entry.
+	targets map[string]int
+	// top is the number of entries with the highest weight, the weight of the node, so that it
+	// is only recomputed when the last of them is removed or lowered.
+	top int
+}
+
+// countWeight counts an entry of the word start n with weight in its highest weight. If
+// counted is set, the entry was counted before with the weight previous. It reports whether
+// the highest weight has to be recomputed from the entries.
+func (n *node) countWeight(weight, previous float64, counted bool) bool {
+	switch {
+	case n.start.top == 0 || weight > n.weight:
+		n.weight, n.start.top = weight, 1
+	case weight == n.weight:
+		if !counted || previous != weight {
+			n.start.top++
+		}
+	case counted && previous == n.weight:
+		return n.uncountWeight(previous)
+	}
+	return false
+}
+
+// uncountWeight removes an entry with weight from the highest weight of the word start n. It
+// reports whether the highest weight has to be recomputed from the entries.
+func (n *node) uncountWeight(weight float64) bool {
+	if weight != n.weight {
+		return false
+	}
+	n.start.top--
+	return n.start.top == 0
+}
+
+// indexWordStarts indexes the later words of the entry of n, whose key is key, in the word
+// starts of t. A word start node has the key of the later word as its word, the keys of the
+// entries it starts a word of as its variants, and the highest of their weights. If indexed is
+// set, the entry was indexed before with the weight previous.
+func (t *Trie) indexWordStarts(key string, n *node, indexed bool, previous float64) {
+	for _, start := range t.startKeys(key, originals(n)) {
+		path := t.startPath(start, true)
+		last := path[len(path)-1]
+		if last.start == nil {
+			last.start = &wordStart{targets: make(map[string]int)}
+		}
+		_, counted := last.start.targets[key]
+		if !counted {
+			last.word = start
+			last.start.targets[key] = len(last.variants)
+			last.variants = append(last.variants, entry{word: key})
+		}
+		if last.countWeight(n.weight, previous, counted && indexed) {
+			t.refreshWordStart(path)
+			continue
+		}
+		for _, p := range path {
+			p.maxWeight = max(p.maxWeight, last.weight)
+		}
+	}
+}
+
+// indexAllWordStarts indexes the later words of every entry in the tree under n.
+func (t *Trie) indexAllWordStarts(n *node) {
+	if n.word != "" {
+		t.indexWordStarts(n.word, n, false, 0)
+	}
+	for _, child := range n.children {
+		t.indexAllWordStarts(child)
+	}
+}
+
+// unindexWordStarts removes the entry with key and the given weight from the word starts with
+// the keys starts.
+func (t *Trie) unindexWordStarts(key string, weight float64, starts []string) {
+	for _, start := range starts {
+		path := t.startPath(start, false)
+		if path == nil {
+			continue
+		}
+		last := path[len(path)-1]
+		if last.start == nil {
+			continue
+		}
+		i, ok := last.start.targets[key]
+		if !ok {
+			continue
+		}
+		// the last entry takes the place of the removed one
+		moved := last.variants[len(last.variants)-1]
+		last.variants[i] = moved
+		last.start.targets[moved.word] = i
+		last.variants = last.variants[:len(last.variants)-1]
+		delete(last.start.targets, key)
+		if len(last.variants) > 0 {
+			if last.uncountWeight(weight) {
+				t.refreshWordStart(path)
+			}
+			continue
+		}
+		last.word = ""
+		last.variants = nil
+		last.start = nil
+		last.weight = 0
+		refreshMaxWeights(prune(path, []rune(start)))
+	}
+}
+
+// startPath returns the nodes from the root of the word starts to the node of key, copying the
+// nodes shared with a snapshot. Missing nodes are created when create is set, and otherwise
+// startPath returns nil.
+func (t *Trie) startPath(key string, create bool) []*node {
+	if t.starts == nil {
+		if !create {
+			return nil
+		}
+		t.starts = &node{children: make(map[rune]*node), gen: t.gen}
+	}
+	t.starts = t.own(t.starts)
+	path := []*node{t.starts}
+	current := t.starts
+	for _, r := range key {
+		child, ok := current.children[r]
+		if !ok {
+			if !create {
+				return nil
+			}
+			// refreshWordStart sets the maxWeight of new nodes
+			child = &node{children: make(map[rune]*node), maxWeight: math.Inf(-1), gen: t.gen}
+		} else {
+			child = t.own(child)
+		}
+		current.children[r] = child
+		current = child
+		path = append(path, current)
+	}
+	return path
+}
+
+// refreshWordStart sets the weight of the word start at the end of path to the highest weight
+// of its entries, and updates maxWeight along the path.
+func (t *Trie) refreshWordStart(path []*node) {
+	last := path[len(path)-1]
+	last.weight, last.start.top = 0, 0
+	for _, target := range last.variants {
+		if n, ok := findIndex[*node](trieIndex{t}, target.word); ok {
+			last.countWeight(n.weight, 0, false)
+		}
+	}
+	refreshMaxWeights(path)
+}
+
+// startsIndex implements index over the word starts of a Trie.
+type startsIndex struct{ trieIndex }
+
+func (si startsIndex) root() *node { return si.t.starts }
+
+func (startsIndex) starts() (index[*node], bool) { return nil, false }
+
+// compactStarts implements index over the word starts of a Compact.
+type compactStarts struct{ *Compact }
+
+func (cs compactStarts) root() uint32 { return cs.startsRoot }
+
+func (compactStarts) starts() (index[uint32], bool) { return nil, false }
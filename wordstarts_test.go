@@ -0,0 +1,148 @@
+package trie
+
+import (
+	"fmt"
+	"maps"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWordStarts(t *testing.T) {
+	exact := []Option{Fuzzy(false), Levenshtein(map[uint8]uint8{0: 0})}
+	newTrie := func(t *testing.T, opts ...Option) *Trie {
+		tr, err := NewWithOptions(append(append(exact, WordStarts(true)), opts...)...)
+		assert.NoError(t, err)
+		return tr
+	}
+
+	t.Run("Off by default", func(t *testing.T) {
+		tr, err := NewWithOptions(exact...)
+		assert.NoError(t, err)
+		tr.Insert("New York")
+		assert.Empty(t, tr.SearchAll("york"))
+	})
+
+	t.Run("Later words", func(t *testing.T) {
+		tr := newTrie(t)
+		tr.InsertWithMeta("New York", 1)
+		tr.InsertWithMeta("MacBook Pro", 2)
+		tr.Insert("T-Shirt")
+		assert.Equal(t, []Match{{Word: "New York", Meta: 1, MidEntry: true}}, tr.SearchAllMeta("york"))
+		assert.Equal(t, []Match{{Word: "MacBook Pro", Meta: 2, MidEntry: true}}, tr.SearchAllMeta("pro"))
+		assert.Equal(t, []string{"T-Shirt"}, tr.SearchAll("shi"))
+		assert.Equal(t, []string{"New York"}, tr.SearchAll("york", Fuzzy(true)))
+		// the later words are not entries of their own
+		_, ok := tr.FindMeta("york")
+		assert.False(t, ok)
+		assert.Equal(t, 3, len(maps.Collect(tr.All())))
+	})
+
+	t.Run("Entry starts rank first and entries are listed once", func(t *testing.T) {
+		tr := newTrie(t)
+		tr.Insert("York", "New York", "York Minster", "New York New York")
+		tr.InsertWeighted("Old York Road", nil, 5)
+		assert.Equal(t, []string{"York", "York Minster", "Old York Road", "New York", "New York New York"}, tr.SearchAll("york"))
+		assert.Equal(t, []string{"York", "York Minster", "Old York Road"}, tr.Search("york", 3))
+		assert.Equal(t, []string{"New York", "New York New York"}, tr.SearchAll("new"))
+		matches := tr.SearchAllMeta("york")
+		assert.False(t, matches[1].MidEntry)
+		assert.True(t, matches[2].MidEntry)
+	})
+
+	t.Run("Entries are ranked together whatever word matched", func(t *testing.T) {
+		tr := newTrie(t)
+		tr.Insert("New York")
+		tr.InsertWeighted("Old Yorkshire Road", nil, 5)
+		tr.InsertWeighted("Great Yorkton", nil, 2)
+		assert.Equal(t, []string{"Old Yorkshire Road", "Great Yorkton", "New York"}, tr.SearchAll("york"))
+		assert.Equal(t, []string{"Old Yorkshire Road"}, tr.Search("york", 1))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		tr := newTrie(t)
+		tr.Insert("New York", "new-york", "New Jersey")
+		assert.True(t, tr.Delete("New York"))
+		assert.Equal(t, []string{"new-york"}, tr.SearchAll("york"))
+		assert.True(t, tr.Delete("new-york"))
+		assert.Empty(t, tr.SearchAll("york"))
+		assert.Empty(t, tr.starts.children['y'])
+		assert.Equal(t, []string{"New Jersey"}, tr.SearchAll("jer"))
+	})
+
+	t.Run("Weights of word starts", func(t *testing.T) {
+		tr := newTrie(t)
+		weight := func() float64 {
+			n, ok := findIndex[*node](startsIndex{trieIndex{tr}}, "york")
+			assert.True(t, ok)
+			return n.weight
+		}
+		tr.InsertWeighted("New York", nil, 5)
+		tr.InsertWeighted("Old York", nil, 5)
+		tr.InsertWeighted("Little York", nil, 1)
+		assert.True(t, tr.Delete("New York"))
+		assert.Equal(t, 5.0, weight())
+		tr.InsertWeighted("Old York", nil, 2)
+		assert.Equal(t, 2.0, weight())
+		tr.InsertWeighted("Little York", nil, 3)
+		assert.Equal(t, 3.0, weight())
+		assert.True(t, tr.Delete("Little York"))
+		assert.Equal(t, 2.0, weight())
+	})
+
+	t.Run("Per-query options", func(t *testing.T) {
+		tr := newTrie(t)
+		tr.Insert("New York", "new york")
+		assert.Empty(t, tr.SearchAll("york", WordStarts(false)))
+		assert.Equal(t, []string{"New York"}, tr.SearchAll("York", CaseSensitivity(true)))
+
+		plain, err := NewWithOptions(exact...)
+		assert.NoError(t, err)
+		plain.Insert("New York")
+		assert.Empty(t, plain.SearchAll("york", WordStarts(true)))
+	})
+
+	t.Run("Reconfigure, snapshots, compact indexes and persistent tries", func(t *testing.T) {
+		tr, err := NewWithOptions(exact...)
+		assert.NoError(t, err)
+		tr.InsertWithMeta("MacBook Pro", 1)
+		tr.Insert("Pro Display")
+		assert.NoError(t, tr.Reconfigure(WordStarts(true)))
+		assert.Equal(t, []string{"Pro Display", "MacBook Pro"}, tr.SearchAll("pro"))
+
+		data, err := tr.MarshalBinary()
+		assert.NoError(t, err)
+		loaded := New()
+		assert.NoError(t, loaded.UnmarshalBinary(data))
+		assert.Equal(t, []string{"Pro Display", "MacBook Pro"}, loaded.SearchAll("pro"))
+
+		c, err := tr.Freeze()
+		assert.NoError(t, err)
+		assert.Equal(t, tr.SearchAllMeta("pro"), c.SearchAllMeta("pro"))
+		assert.Equal(t, []string{"Pro Display", "MacBook Pro"}, c.SearchAll("Pro", CaseSensitivity(true)))
+		assert.Empty(t, c.SearchAll("pro", CaseSensitivity(true)))
+
+		p := NewPersistent()
+		p.Update(func(tr *Trie) {
+			assert.NoError(t, tr.Reconfigure(WordStarts(true)))
+			tr.Insert("New York")
+		})
+		before := p.Snapshot()
+		p.Update(func(tr *Trie) { tr.Delete("New York") })
+		assert.Equal(t, []string{"New York"}, before.SearchAll("york"))
+		assert.Empty(t, p.SearchAll("york"))
+	})
+}
+
+func BenchmarkInsertWordStarts(b *testing.B) {
+	t, err := NewWithOptions(WordStarts(true))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	// every entry shares the later word "york"
+	for n := 0; n < b.N; n++ {
+		t.Insert(fmt.Sprintf("item %d york", n))
+	}
+}